@@ -0,0 +1,184 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"io"
+	"log/slog"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// command is one node of the command tree, a node either runs or has children.
+type command struct {
+	name     string
+	args     string
+	usage    string
+	run      func(b *bootstrap, args []string) error
+	children []*command
+}
+
+// bootstrap holds the global flags and loads what every command shares.
+type bootstrap struct {
+	path  string
+	flags map[string]string
+	out   io.Writer
+}
+
+func (b *bootstrap) config() (config.IConfig, error) {
+	cfg, err := config.LoadConfig(b.path, b.flags)
+	if err != nil {
+		return nil, fmt.Errorf("load config failed: %v", err)
+	}
+	// Logs go to stderr, stdout is left to the command's own output
+	slog.SetDefault(kwanjailogger.New(cfg.Log(), os.Stderr))
+	return cfg, nil
+}
+
+func (b *bootstrap) db(cfg config.IConfig) (*sqlx.DB, error) {
+	return databases.DbConnect(context.Background(), cfg.Db())
+}
+
+func root() *command {
+	return &command{
+		name: os.Args[0],
+		children: []*command{
+			serveCommand(),
+			migrateCommand(),
+			seedCommand(),
+			userCommand(),
+			tokenCommand(),
+			configCommand(),
+		},
+	}
+}
+
+// Execute runs the command named by args and returns the process exit code.
+// Without a command the server is started, as it was before subcommands existed.
+func Execute(args []string) int {
+	global := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	configPath := global.String("config", "", "path to a .env or YAML config file (default .env)")
+	printConfig := global.Bool("print-config", false, "print the effective configuration with secrets masked and exit")
+	configFlags := config.RegisterFlags(global)
+	r := root()
+	global.Usage = func() { r.printUsage(global.Output(), global) }
+	if err := global.Parse(args); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		return 2
+	}
+
+	b := &bootstrap{
+		flags: configFlags.Values(),
+		out:   os.Stdout,
+	}
+
+	rest := global.Args()
+	// Older deployments pass the env file as the only argument
+	if len(rest) > 0 && r.child(rest[0]) == nil && isFile(rest[0]) {
+		*configPath, rest = rest[0], rest[1:]
+	}
+	b.path = envPath(*configPath)
+	if *printConfig {
+		rest = []string{"config", "check", "--print"}
+	}
+	if len(rest) == 0 {
+		rest = []string{"serve"}
+	}
+
+	if err := r.execute(b, rest); err != nil {
+		// The flag set of the command has printed its usage already
+		if errors.Is(err, flag.ErrHelp) {
+			return 0
+		}
+		fmt.Fprintf(os.Stderr, "error: %v\n", err)
+		return 1
+	}
+	return 0
+}
+
+func (c *command) child(name string) *command {
+	for _, ch := range c.children {
+		if ch.name == name {
+			return ch
+		}
+	}
+	return nil
+}
+
+func (c *command) execute(b *bootstrap, args []string) error {
+	if c.run != nil {
+		return c.run(b, args)
+	}
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		c.printUsage(os.Stderr, nil)
+		return nil
+	}
+	ch := c.child(args[0])
+	if ch == nil {
+		c.printUsage(os.Stderr, nil)
+		return fmt.Errorf("unknown command %q", strings.TrimSpace(c.path()+" "+args[0]))
+	}
+	return ch.execute(b, args[1:])
+}
+
+func (c *command) path() string {
+	if c.name == os.Args[0] {
+		return ""
+	}
+	return c.name
+}
+
+func (c *command) printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s [global flags] %s\n\nCommands:\n", os.Args[0], strings.TrimSpace(c.path()+" <command>"))
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	var walk func(prefix string, cmd *command)
+	walk = func(prefix string, cmd *command) {
+		for _, ch := range cmd.children {
+			name := strings.TrimSpace(prefix + " " + ch.name)
+			if ch.run != nil {
+				fmt.Fprintf(tw, "  %s\t%s\t%s\n", name, ch.args, ch.usage)
+			}
+			walk(name, ch)
+		}
+	}
+	walk(c.path(), c)
+	tw.Flush()
+	if global != nil {
+		fmt.Fprintf(w, "\nGlobal flags:\n")
+		global.PrintDefaults()
+	}
+}
+
+func envPath(configPath string) string {
+	if configPath != "" {
+		return configPath
+	}
+	// The default .env file is optional, the OS environment may hold everything
+	if !isFile(".env") {
+		return ""
+	}
+	return ".env"
+}
+
+func isFile(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return false
+	}
+	return !info.IsDir()
+}
+
+// newFlagSet parses the flags of a leaf command.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
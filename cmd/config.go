@@ -0,0 +1,42 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+)
+
+func configCommand() *command {
+	return &command{
+		name: "config",
+		children: []*command{
+			{name: "check", args: "[--print]", usage: "validate the configuration and list every problem", run: configCheck},
+		},
+	}
+}
+
+func configCheck(b *bootstrap, args []string) error {
+	fs := newFlagSet("config check")
+	printCfg := fs.Bool("print", false, "print the effective configuration with secrets masked")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	cfg, err := config.LoadConfig(b.path, b.flags)
+	if err != nil {
+		var cfgErr *config.ConfigError
+		if errors.As(err, &cfgErr) {
+			for _, p := range cfgErr.Problems {
+				fmt.Fprintf(b.out, "%s: %s\n", p.Key, p.Reason)
+			}
+			return fmt.Errorf("config has %d problem(s)", len(cfgErr.Problems))
+		}
+		return err
+	}
+
+	if *printCfg {
+		return config.PrintConfig(b.out, cfg)
+	}
+	fmt.Fprintln(b.out, "config is valid")
+	return nil
+}
@@ -0,0 +1,103 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"strconv"
+	"text/tabwriter"
+)
+
+func migrateCommand() *command {
+	return &command{
+		name: "migrate",
+		children: []*command{
+			{name: "up", args: "[N]", usage: "apply the next N pending migrations, all by default", run: migrateUp},
+			{name: "down", args: "[N]", usage: "roll back the last N migrations, 1 by default", run: migrateDown},
+			{name: "status", usage: "list migrations and whether they are applied", run: migrateStatus},
+			{name: "create", args: "<name>", usage: "write an empty up/down migration pair", run: migrateCreate},
+		},
+	}
+}
+
+func (b *bootstrap) migrator(run func(m databases.IMigrator) error) error {
+	cfg, err := b.config()
+	if err != nil {
+		return err
+	}
+	db, err := b.db(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	migrator, err := databases.Migrator(db)
+	if err != nil {
+		return err
+	}
+	return run(migrator)
+}
+
+func migrateUp(b *bootstrap, args []string) error {
+	n, err := migrateSteps(args, 0)
+	if err != nil {
+		return err
+	}
+	return b.migrator(func(m databases.IMigrator) error {
+		return m.Up(context.Background(), n)
+	})
+}
+
+func migrateDown(b *bootstrap, args []string) error {
+	n, err := migrateSteps(args, 1)
+	if err != nil {
+		return err
+	}
+	return b.migrator(func(m databases.IMigrator) error {
+		return m.Down(context.Background(), n)
+	})
+}
+
+func migrateStatus(b *bootstrap, args []string) error {
+	return b.migrator(func(m databases.IMigrator) error {
+		status, err := m.Status(context.Background())
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(b.out, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+		for _, s := range status {
+			state, at := "pending", ""
+			if s.Applied {
+				state, at = "applied", s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%06d\t%s\t%s\t%s\n", s.Version, s.Name, state, at)
+		}
+		return w.Flush()
+	})
+}
+
+func migrateCreate(b *bootstrap, args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("usage: migrate create <name>")
+	}
+	files, err := databases.CreateMigration(databases.MigrationsDir, args[0])
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		fmt.Fprintln(b.out, f)
+	}
+	return nil
+}
+
+func migrateSteps(args []string, def int) (int, error) {
+	if len(args) == 0 {
+		return def, nil
+	}
+	n, err := strconv.Atoi(args[0])
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("steps must be a positive integer, got %q", args[0])
+	}
+	return n, nil
+}
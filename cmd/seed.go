@@ -0,0 +1,68 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases/seeds"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaipassword"
+	"strings"
+)
+
+func seedCommand() *command {
+	return &command{
+		name:  "seed",
+		args:  "<profile> | --file",
+		usage: "upsert fixture data: " + strings.Join(seeds.Profiles(), ", ") + ", or a fixture file",
+		run:   seed,
+	}
+}
+
+func seed(b *bootstrap, args []string) error {
+	fs := newFlagSet("seed")
+	file := fs.String("file", "", "YAML or JSON fixture file to load instead of a built-in profile")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var (
+		fixture *seeds.Fixture
+		err     error
+		source  string
+	)
+	if *file != "" {
+		source = *file
+		fixture, err = seeds.LoadFile(*file)
+	} else {
+		// No default, the demo profile has a known admin password
+		if fs.NArg() == 0 {
+			return fmt.Errorf("usage: seed <profile> | --file <path>")
+		}
+		source = fs.Arg(0)
+		fixture, err = seeds.LoadProfile(source)
+	}
+	if err != nil {
+		return err
+	}
+
+	cfg, err := b.config()
+	if err != nil {
+		return err
+	}
+	db, err := b.db(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if err := seeds.Seed(context.Background(), db, kwanjaipassword.Hasher(cfg.Password()), fixture); err != nil {
+		return err
+	}
+	fmt.Fprintf(b.out, "seeded %s: %d users, %d categories, %d products, %d orders\n",
+		source,
+		len(fixture.Users),
+		len(fixture.Categories),
+		len(fixture.Products),
+		len(fixture.Orders),
+	)
+	return nil
+}
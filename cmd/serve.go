@@ -0,0 +1,105 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/servers"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+func serveCommand() *command {
+	return &command{
+		name:  "serve",
+		usage: "start the HTTP server",
+		run:   serve,
+	}
+}
+
+// flushTimeout bounds how long the queued audit entries, spans and log
+// records may take to reach their sinks once the server has stopped.
+const flushTimeout = 10 * time.Second
+
+func serve(b *bootstrap, args []string) error {
+	cfg, err := b.config()
+	if err != nil {
+		return err
+	}
+
+	sinks, err := kwanjailogger.Sinks(cfg.Log(), os.Stdout)
+	if err != nil {
+		return fmt.Errorf("open log sinks failed: %v", err)
+	}
+	slog.SetDefault(sinks.Logger())
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := sinks.Close(ctx); err != nil {
+			fmt.Fprintf(os.Stderr, "close log sinks failed: %v\n", err)
+		}
+	}()
+
+	db, err := b.db(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	if cfg.Db().MigrateOnBoot() {
+		migrator, err := databases.Migrator(db)
+		if err != nil {
+			return fmt.Errorf("load migrations failed: %v", err)
+		}
+		if err := migrator.Up(context.Background(), 0); err != nil {
+			return fmt.Errorf("migrate on boot failed: %v", err)
+		}
+	}
+
+	cluster, err := databases.Cluster(cfg.Db(), db)
+	if err != nil {
+		return err
+	}
+	defer cluster.Close()
+
+	// Deferred after the pools so the spans and audit entries of the last
+	// requests are flushed before the database is closed
+	tracing, err := kwanjaitrace.Provider(cfg, os.Stdout)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+		defer cancel()
+		if err := tracing.Close(ctx); err != nil {
+			slog.Error("close tracing failed", "error", err)
+		}
+	}()
+
+	if cfg.Audit().Enabled() {
+		audit := kwanjailogger.AuditWriter(cfg.Audit(), slog.Default())
+		kwanjailogger.SetAudit(audit)
+		defer func() {
+			ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+			defer cancel()
+			if err := audit.Close(ctx); err != nil {
+				slog.Error("close audit log failed", "error", err, "dropped", audit.Dropped())
+			}
+		}()
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		// A second signal kills the process instead of waiting for the drain
+		<-ctx.Done()
+		stop()
+	}()
+
+	return servers.NewServer(cfg, slog.Default(), cluster).Start(ctx)
+}
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersUsecases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaiauth"
+)
+
+func tokenCommand() *command {
+	return &command{
+		name: "token",
+		children: []*command{
+			{name: "issue", args: "--type [--user]", usage: "sign an access, refresh or admin token", run: tokenIssue},
+		},
+	}
+}
+
+// tokenIssue signs a token without storing it in oauth, so access tokens
+// issued here do not pass JwtAuth. It is meant for admin tokens and debugging.
+func tokenIssue(b *bootstrap, args []string) error {
+	fs := newFlagSet("token issue")
+	tokenType := fs.String("type", string(kwanjaiauth.Admin), "token type: access, refresh or admin")
+	userId := fs.String("user", "", "user id the token is issued for, required unless --type admin")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if kwanjaiauth.TokenType(*tokenType) == kwanjaiauth.Admin {
+		cfg, err := b.config()
+		if err != nil {
+			return err
+		}
+		return printToken(b, cfg, kwanjaiauth.Admin, nil)
+	}
+
+	if *userId == "" {
+		return fmt.Errorf("--user is required for %s tokens", *tokenType)
+	}
+	return b.usersUsecase(func(cfg config.IConfig, u usersUsecases.IUsersUsecase) error {
+		profile, err := u.GetUserProfile(context.Background(), *userId)
+		if err != nil {
+			return err
+		}
+		return printToken(b, cfg, kwanjaiauth.TokenType(*tokenType), &users.UserClaims{
+			Id:     profile.Id,
+			RoleId: profile.RoleId,
+		})
+	})
+}
+
+func printToken(b *bootstrap, cfg config.IConfig, tokenType kwanjaiauth.TokenType, claims *users.UserClaims) error {
+	token, err := kwanjaiauth.NewKwanjaiAuth(tokenType, cfg.Jwt(), claims)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(b.out, token.SignToken())
+	return nil
+}
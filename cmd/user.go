@@ -0,0 +1,106 @@
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersRepositories"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersUsecases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaivalidator"
+	"log/slog"
+	"strings"
+)
+
+func userCommand() *command {
+	return &command{
+		name: "user",
+		children: []*command{
+			{name: "create-admin", args: "--email --username --password", usage: "create an admin account", run: userCreateAdmin},
+			{name: "reset-password", args: "--email --password", usage: "set a new password and sign the user out", run: userResetPassword},
+		},
+	}
+}
+
+func (b *bootstrap) usersUsecase(run func(cfg config.IConfig, u usersUsecases.IUsersUsecase) error) error {
+	cfg, err := b.config()
+	if err != nil {
+		return err
+	}
+	db, err := b.db(cfg)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	logger := slog.Default()
+	return run(cfg, usersUsecases.UsersUsecase(cfg, logger, usersRepositories.UsersRepository(cfg.Db(), logger, databases.Single(db))))
+}
+
+func userCreateAdmin(b *bootstrap, args []string) error {
+	fs := newFlagSet("user create-admin")
+	email := fs.String("email", "", "admin email")
+	username := fs.String("username", "", "admin username")
+	password := fs.String("password", "", "admin password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	req := &users.UserRegisterReq{
+		Email:    *email,
+		Username: *username,
+		Password: *password,
+	}
+	if err := flagsError(kwanjaivalidator.Validate(req)); err != nil {
+		return err
+	}
+
+	return b.usersUsecase(func(cfg config.IConfig, u usersUsecases.IUsersUsecase) error {
+		result, err := u.InsertAdmin(context.Background(), req)
+		if err != nil {
+			return flagsError(err)
+		}
+		fmt.Fprintf(b.out, "admin %s created with id %s\n", result.User.Username, result.User.Id)
+		return nil
+	})
+}
+
+func userResetPassword(b *bootstrap, args []string) error {
+	fs := newFlagSet("user reset-password")
+	email := fs.String("email", "", "account email")
+	password := fs.String("password", "", "new password")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	req := &users.UserCredential{
+		Email:    *email,
+		Password: *password,
+	}
+	if err := flagsError(kwanjaivalidator.Validate(req)); err != nil {
+		return err
+	}
+
+	return b.usersUsecase(func(cfg config.IConfig, u usersUsecases.IUsersUsecase) error {
+		if err := u.ResetPassword(context.Background(), req); err != nil {
+			return flagsError(err)
+		}
+		fmt.Fprintf(b.out, "password of %s has been reset\n", req.Email)
+		return nil
+	})
+}
+
+// flagsError reports validation failures by the flag that set the field.
+func flagsError(err error) error {
+	fields := apperrors.FieldsOf(err)
+	if len(fields) == 0 {
+		return err
+	}
+	problems := make([]string, 0, len(fields))
+	for _, f := range fields {
+		problems = append(problems, fmt.Sprintf("--%s %s", f.Field, f.Message))
+	}
+	return fmt.Errorf("%s", strings.Join(problems, ", "))
+}
@@ -2,116 +2,313 @@ package config
 
 import (
 	"fmt"
-	"log"
-	"math"
+	"log/slog"
+	"net"
+	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
-
-	"github.com/joho/godotenv"
 )
 
-func LoadConfig(path string) IConfig {
-	envMap, err := godotenv.Read(path)
+// logger is looked up on every call, the default logger is only set up
+// once the config it depends on is loaded.
+func logger() *slog.Logger {
+	return slog.Default().With("package", "config")
+}
+
+// LoadConfig reads the configuration from path (a .env or YAML file, optional),
+// the OS environment and the command-line flag values, in increasing precedence.
+func LoadConfig(path string, flags map[string]string) (IConfig, error) {
+	envMap, err := resolve(path, flags)
 	if err != nil {
-		log.Fatalf("load dotenv failed: %v", err)
+		return nil, err
+	}
+
+	snap, err := build(envMap)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &config{
+		path:      path,
+		flags:     flags,
+		overrides: make(map[string]string),
 	}
+	cfg.store(snap)
+	return cfg, nil
+}
 
-	return &config{
+func build(envMap map[string]string) (*snapshot, error) {
+	env := newEnvReader(envMap)
+	_, applicationName := env.firstString("DB_APPLICATION_NAME", "APP_NAME")
+	_, serviceName := env.firstString("TRACE_SERVICE_NAME", "APP_NAME")
+	snap := &snapshot{
+		envMap: envMap,
 		app: &app{
-			host: envMap["APP_HOST"],
-			port: func() int {
-				p, err := strconv.Atoi(envMap["APP_PORT"])
-				if err != nil {
-					log.Fatalf("load port failed: %v", err)
-				}
-				return p
-			}(),
-			name:    envMap["APP_NAME"],
-			version: envMap["APP_VERSION"],
-			readTimeout: func() time.Duration {
-				t, err := strconv.Atoi(envMap["APP_READ_TIMEOUT"])
-				if err != nil {
-					log.Fatalf("load read timeout failed: %v", err)
-				}
-				return time.Duration(int64(t) * int64(math.Pow10(9)))
-			}(),
-			writeTimeout: func() time.Duration {
-				t, err := strconv.Atoi(envMap["APP_WRTIE_TIMEOUT"])
-				if err != nil {
-					log.Fatalf("load write timeout failed: %v", err)
-				}
-				return time.Duration(int64(t) * int64(math.Pow10(9)))
-			}(),
-			bodyLimit: func() int {
-				b, err := strconv.Atoi(envMap["APP_BODY_LIMIT"])
-				if err != nil {
-					log.Fatalf("load body limit failed: %v", err)
-				}
-				return b
-			}(),
-			fileLimit: func() int {
-				b, err := strconv.Atoi(envMap["APP_FILE_LIMIT"])
-				if err != nil {
-					log.Fatalf("load file limit failed: %v", err)
-				}
-				return b
-			}(),
-			gcpbucket: envMap["APP_GCP_BUCKET"],
+			host:            env.string("APP_HOST"),
+			port:            env.positiveInt("APP_PORT"),
+			name:            env.requiredString("APP_NAME"),
+			version:         env.string("APP_VERSION"),
+			readTimeout:     env.duration("APP_READ_TIMEOUT"),
+			writeTimeout:    env.duration("APP_WRITE_TIMEOUT", "APP_WRTIE_TIMEOUT"),
+			bodyLimit:       env.size("APP_BODY_LIMIT"),
+			fileLimit:       env.size("APP_FILE_LIMIT"),
+			gcpbucket:       env.string("APP_GCP_BUCKET"),
+			corsOrigins:     env.list("APP_CORS_ORIGINS"),
+			rateLimitMax:    env.nonNegativeInt("APP_RATE_LIMIT_MAX"),
+			rateLimitWindow: env.duration("APP_RATE_LIMIT_WINDOW"),
+			errorFormat:     env.oneOf("APP_ERROR_FORMAT", errorFormats),
+			healthTimeout:   env.duration("APP_HEALTH_CHECK_TIMEOUT"),
+			shutdownDelay:   env.optionalDuration("APP_SHUTDOWN_DELAY"),
+			shutdownTimeout: env.duration("APP_SHUTDOWN_TIMEOUT"),
 		},
 		db: &db{
-			host: envMap["DB_HOST"],
-			port: func() int {
-				p, err := strconv.Atoi(envMap["DB_PORT"])
-				if err != nil {
-					log.Fatalf("load db port failed: %v", err)
-				}
-				return p
-			}(),
-			protocol: envMap["DB_PROTOCOL"],
-			username: envMap["DB_USERNAME"],
-			password: envMap["DB_PASSWORD"],
-			database: envMap["DB_DATABASE"],
-			sslMode:  envMap["DB_SSL_MODE"],
-			maxConnections: func() int {
-				m, err := strconv.Atoi(envMap["DB_MAX_CONNECTIONS"])
-				if err != nil {
-					log.Fatalf("load db max connections failed: %v", err)
-				}
-				return m
-			}(),
+			host:               env.requiredString("DB_HOST"),
+			port:               env.positiveInt("DB_PORT"),
+			protocol:           env.oneOf("DB_PROTOCOL", dbProtocols),
+			username:           env.requiredString("DB_USERNAME"),
+			password:           env.string("DB_PASSWORD"),
+			database:           env.requiredString("DB_DATABASE"),
+			sslMode:            env.oneOf("DB_SSL_MODE", sslModes),
+			sslRootCert:        env.string("DB_SSL_ROOT_CERT"),
+			sslCert:            env.string("DB_SSL_CERT"),
+			sslKey:             env.string("DB_SSL_KEY"),
+			applicationName:    applicationName,
+			maxConnections:     env.positiveInt("DB_MAX_CONNECTIONS"),
+			maxIdleConnections: env.nonNegativeInt("DB_MAX_IDLE_CONNECTIONS"),
+			connMaxLifetime:    env.optionalDuration("DB_CONN_MAX_LIFETIME"),
+			connMaxIdleTime:    env.optionalDuration("DB_CONN_MAX_IDLE_TIME"),
+			statementTimeout:   env.optionalDuration("DB_STATEMENT_TIMEOUT"),
+			connectTimeout:     env.optionalDuration("DB_CONNECT_TIMEOUT"),
+			replicaUrls:        env.list("DB_REPLICA_URLS"),
+			replicaCheck:       env.duration("DB_REPLICA_CHECK_INTERVAL"),
+			queryTimeout:       env.duration("DB_QUERY_TIMEOUT"),
+			migrateOnBoot:      env.bool("DB_MIGRATE_ON_BOOT"),
 		},
 		jwt: &jwt{
-			adminKey:  envMap["JWT_ADMIN_KEY"],
-			secertKey: envMap["JWT_SECRET_KEY"],
-			apiKey:    envMap["JWT_API_KEY"],
-			accessExpiresAt: func() int {
-				t, err := strconv.Atoi(envMap["JWT_ACCESS_EXPIRES"])
-				if err != nil {
-					log.Fatalf("load access expires at failed: %v", err)
-				}
-				return t
-			}(),
-			refreshExpiresAt: func() int {
-				t, err := strconv.Atoi(envMap["JWT_REFRESH_EXPIRES"])
-				if err != nil {
-					log.Fatalf("load refresh expires at failed: %v", err)
-				}
-				return t
-			}(),
+			secertKey:        env.secret("JWT_SECRET_KEY"),
+			adminKey:         env.secret("JWT_ADMIN_KEY"),
+			apiKey:           env.secret("JWT_API_KEY"),
+			accessExpiresAt:  env.duration("JWT_ACCESS_EXPIRES"),
+			refreshExpiresAt: env.duration("JWT_REFRESH_EXPIRES"),
+		},
+		password: &password{
+			minLength:        env.positiveInt("PASSWORD_MIN_LENGTH"),
+			characterClasses: env.listOf("PASSWORD_CHARACTER_CLASSES", passwordClasses),
+			denyList:         env.lines("PASSWORD_DENY_LIST_FILE"),
+			hash:             env.oneOf("PASSWORD_HASH", passwordHashes),
+			bcryptCost:       env.intBetween("PASSWORD_BCRYPT_COST", 4, 31),
+			argon2Memory:     env.size("PASSWORD_ARGON2_MEMORY"),
+			argon2Iterations: env.positiveInt("PASSWORD_ARGON2_ITERATIONS"),
+			argon2Threads:    env.intBetween("PASSWORD_ARGON2_THREADS", 1, 255),
+		},
+		metrics: &metrics{
+			enabled:  env.bool("METRICS_ENABLED"),
+			path:     env.string("METRICS_PATH"),
+			username: env.string("METRICS_USERNAME"),
+			password: env.string("METRICS_PASSWORD"),
+			allowIps: env.networks("METRICS_ALLOW_IPS"),
+		},
+		trace: &trace{
+			enabled:      env.bool("TRACE_ENABLED"),
+			exporter:     env.oneOf("TRACE_EXPORTER", traceExporters),
+			serviceName:  serviceName,
+			sampleRatio:  env.ratio("TRACE_SAMPLE_RATIO"),
+			otlpEndpoint: env.string("TRACE_OTLP_ENDPOINT"),
+			otlpInsecure: env.bool("TRACE_OTLP_INSECURE"),
+			otlpHeaders:  env.pairs("TRACE_OTLP_HEADERS"),
+		},
+		audit: &audit{
+			enabled:       env.bool("AUDIT_LOG_ENABLED"),
+			dir:           env.string("AUDIT_LOG_DIR"),
+			maxSize:       env.size("AUDIT_LOG_MAX_SIZE"),
+			maxAge:        env.optionalDuration("AUDIT_LOG_MAX_AGE"),
+			maxFiles:      env.nonNegativeInt("AUDIT_LOG_MAX_FILES"),
+			compress:      env.bool("AUDIT_LOG_COMPRESS"),
+			buffer:        env.positiveInt("AUDIT_LOG_BUFFER"),
+			overflow:      env.oneOf("AUDIT_LOG_OVERFLOW", auditOverflows),
+			flushInterval: env.duration("AUDIT_LOG_FLUSH_INTERVAL"),
+		},
+		log: &logConfig{
+			level:         env.oneOf("LOG_LEVEL", logLevels),
+			packageLevels: env.levels("LOG_PACKAGE_LEVELS", logLevels),
+			format:        env.oneOf("LOG_FORMAT", logFormats),
+			redactFields:  env.patterns("LOG_REDACT_FIELDS"),
+			redactPartial: env.patterns("LOG_REDACT_PARTIAL"),
+			redactHeaders: env.list("LOG_REDACT_HEADERS"),
+			stdout: &logSink{
+				enabled: env.bool("LOG_STDOUT_ENABLED"),
+				level:   env.oneOf("LOG_STDOUT_LEVEL", logLevels),
+			},
+			file: &logFile{
+				logSink: logSink{
+					enabled: env.bool("LOG_FILE_ENABLED"),
+					level:   env.oneOf("LOG_FILE_LEVEL", logLevels),
+				},
+				dir:      env.string("LOG_FILE_DIR"),
+				maxSize:  env.size("LOG_FILE_MAX_SIZE"),
+				maxAge:   env.optionalDuration("LOG_FILE_MAX_AGE"),
+				maxFiles: env.nonNegativeInt("LOG_FILE_MAX_FILES"),
+				compress: env.bool("LOG_FILE_COMPRESS"),
+			},
+			syslog: &logSyslog{
+				logSink: logSink{
+					enabled: env.bool("LOG_SYSLOG_ENABLED"),
+					level:   env.oneOf("LOG_SYSLOG_LEVEL", logLevels),
+				},
+				network: env.oneOf("LOG_SYSLOG_NETWORK", syslogNetworks),
+				address: env.string("LOG_SYSLOG_ADDRESS"),
+			},
+			http: &logHttp{
+				logSink: logSink{
+					enabled: env.bool("LOG_HTTP_ENABLED"),
+					level:   env.oneOf("LOG_HTTP_LEVEL", logLevels),
+				},
+				url:           env.string("LOG_HTTP_URL"),
+				token:         env.string("LOG_HTTP_TOKEN"),
+				batchSize:     env.positiveInt("LOG_HTTP_BATCH_SIZE"),
+				flushInterval: env.duration("LOG_HTTP_FLUSH_INTERVAL"),
+				retries:       env.nonNegativeInt("LOG_HTTP_RETRIES"),
+				timeout:       env.duration("LOG_HTTP_TIMEOUT"),
+			},
 		},
 	}
+	if (snap.metrics.username == "") != (snap.metrics.password == "") {
+		env.report("METRICS_PASSWORD", "METRICS_USERNAME and METRICS_PASSWORD must be set together")
+	}
+	// The keys of a feature are only checked when it is enabled
+	env.requiredWhen(snap.metrics.enabled, "METRICS_ENABLED", "METRICS_PATH", snap.metrics.path)
+	if snap.metrics.enabled && snap.metrics.path != "" && !strings.HasPrefix(snap.metrics.path, "/") {
+		env.report("METRICS_PATH", "must start with /")
+	}
+	env.requiredWhen(snap.trace.enabled && snap.trace.exporter == "otlp", "TRACE_ENABLED", "TRACE_OTLP_ENDPOINT", snap.trace.otlpEndpoint)
+	env.requiredWhen(snap.audit.enabled, "AUDIT_LOG_ENABLED", "AUDIT_LOG_DIR", snap.audit.dir)
+	env.requiredWhen(snap.log.file.enabled, "LOG_FILE_ENABLED", "LOG_FILE_DIR", snap.log.file.dir)
+	env.requiredWhen(snap.log.syslog.enabled, "LOG_SYSLOG_ENABLED", "LOG_SYSLOG_ADDRESS", snap.log.syslog.address)
+	if snap.log.http.enabled {
+		if u, err := url.Parse(snap.log.http.url); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			env.report("LOG_HTTP_URL", "must be an http(s) URL when LOG_HTTP_ENABLED is true")
+		}
+	}
+	if (snap.db.sslCert == "") != (snap.db.sslKey == "") {
+		env.report("DB_SSL_KEY", "DB_SSL_CERT and DB_SSL_KEY must be set together")
+	}
+	if err := env.err(); err != nil {
+		return nil, err
+	}
+	return snap, nil
 }
 
 type IConfig interface {
 	App() IAppConfig
 	Db() IDbConfig
 	Jwt() IJwtConfig
+	Password() IPasswordConfig
+	Metrics() IMetricsConfig
+	Trace() ITraceConfig
+	Audit() IAuditConfig
+	Log() ILogConfig
+	Reload() error
+	// Override sets a reloadable key at run time, above every other source,
+	// so it survives the next Reload.
+	Override(key, value string) error
 }
 
+// config hands out the sections of the current snapshot, a reload swaps the
+// whole snapshot so readers never see a half applied change.
 type config struct {
-	app *app
-	db  *db
-	jwt *jwt
+	path      string
+	flags     map[string]string
+	mu        sync.Mutex // serializes reloads and overrides
+	overrides map[string]string
+	current   atomic.Pointer[snapshot]
+}
+
+// store makes snap the current snapshot. The JWT setters write back through
+// the config, a snapshot is never changed once stored.
+func (c *config) store(snap *snapshot) {
+	snap.jwt.override = c.Override
+	c.current.Store(snap)
+}
+
+type snapshot struct {
+	envMap   map[string]string
+	app      *app
+	db       *db
+	jwt      *jwt
+	password *password
+	metrics  *metrics
+	trace    *trace
+	audit    *audit
+	log      *logConfig
+}
+
+// Reload reads every source again and applies the keys marked as reloadable.
+// Changes to any other key are logged and ignored until the next restart.
+func (c *config) Reload() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	envMap, err := resolve(c.path, c.flags)
+	if err != nil {
+		return err
+	}
+	for env, v := range c.overrides {
+		envMap[env] = v
+	}
+
+	cur := c.current.Load()
+	merged := make(map[string]string)
+	for _, k := range keys {
+		if k.reload {
+			if v, ok := envMap[k.env]; ok {
+				merged[k.env] = v
+			}
+			continue
+		}
+		if envMap[k.env] != cur.envMap[k.env] {
+			logger().Warn("key changed but requires a restart, keeping the running value", "key", k.env)
+		}
+		if v, ok := cur.envMap[k.env]; ok {
+			merged[k.env] = v
+		}
+	}
+
+	next, err := build(merged)
+	if err != nil {
+		return err
+	}
+	c.store(next)
+	return nil
+}
+
+func (c *config) Override(key, value string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	k := lookupKey(key)
+	if k == nil {
+		return fmt.Errorf("override %s failed: unknown key", key)
+	}
+	if !k.reload {
+		return fmt.Errorf("override %s failed: key is not reloadable", key)
+	}
+
+	cur := c.current.Load()
+	envMap := make(map[string]string, len(cur.envMap)+1)
+	for env, v := range cur.envMap {
+		envMap[env] = v
+	}
+	envMap[key] = value
+	next, err := build(envMap)
+	if err != nil {
+		return fmt.Errorf("override %s failed: %v", key, err)
+	}
+	c.overrides[key] = value
+	c.store(next)
+	return nil
 }
 
 type IAppConfig interface {
@@ -125,6 +322,13 @@ type IAppConfig interface {
 	GCPBucket() string
 	Host() string
 	Port() int
+	CorsOrigins() []string
+	RateLimitMax() int
+	RateLimitWindow() time.Duration
+	ErrorFormat() string
+	HealthCheckTimeout() time.Duration
+	ShutdownDelay() time.Duration // 0 stops taking requests at once
+	ShutdownTimeout() time.Duration
 }
 
 type app struct {
@@ -137,79 +341,407 @@ type app struct {
 	bodyLimit    int //bytes
 	fileLimit    int //bytes
 	gcpbucket    string
+
+	corsOrigins     []string
+	rateLimitMax    int // requests per window, 0 disables the limiter
+	rateLimitWindow time.Duration
+	errorFormat     string // json or problem
+	healthTimeout   time.Duration
+	shutdownDelay   time.Duration
+	shutdownTimeout time.Duration
 }
 
 func (c *config) App() IAppConfig {
-	return c.app
-}
-func (a *app) Url() string                 { return fmt.Sprintf("%s:%d", a.host, a.port) } // host:port
-func (a *app) Name() string                { return a.name }
-func (a *app) Version() string             { return a.version }
-func (a *app) ReadTimeout() time.Duration  { return a.readTimeout }
-func (a *app) WriteTimeout() time.Duration { return a.writeTimeout }
-func (a *app) BodyLimit() int              { return a.bodyLimit }
-func (a *app) FileLimit() int              { return a.fileLimit }
-func (a *app) GCPBucket() string           { return a.gcpbucket }
-func (a *app) Host() string                { return a.host }
-func (a *app) Port() int                   { return a.port }
+	return c.current.Load().app
+}
+func (a *app) Url() string                       { return fmt.Sprintf("%s:%d", a.host, a.port) } // host:port
+func (a *app) Name() string                      { return a.name }
+func (a *app) Version() string                   { return a.version }
+func (a *app) ReadTimeout() time.Duration        { return a.readTimeout }
+func (a *app) WriteTimeout() time.Duration       { return a.writeTimeout }
+func (a *app) BodyLimit() int                    { return a.bodyLimit }
+func (a *app) FileLimit() int                    { return a.fileLimit }
+func (a *app) GCPBucket() string                 { return a.gcpbucket }
+func (a *app) Host() string                      { return a.host }
+func (a *app) Port() int                         { return a.port }
+func (a *app) CorsOrigins() []string             { return a.corsOrigins }
+func (a *app) RateLimitMax() int                 { return a.rateLimitMax }
+func (a *app) RateLimitWindow() time.Duration    { return a.rateLimitWindow }
+func (a *app) ErrorFormat() string               { return a.errorFormat }
+func (a *app) HealthCheckTimeout() time.Duration { return a.healthTimeout }
+func (a *app) ShutdownDelay() time.Duration      { return a.shutdownDelay }
+func (a *app) ShutdownTimeout() time.Duration    { return a.shutdownTimeout }
 
 type IDbConfig interface {
 	Url() string
 	MaxOpenConns() int
+	MaxIdleConns() int
+	ConnMaxLifetime() time.Duration
+	ConnMaxIdleTime() time.Duration
+	StatementTimeout() time.Duration
+	ApplicationName() string
+	ConnectTimeout() time.Duration
+	ReplicaUrls() []string
+	ReplicaCheckInterval() time.Duration
+	QueryTimeout() time.Duration
+	MigrateOnBoot() bool
 }
 
 type db struct {
-	host           string
-	port           int
-	protocol       string
-	username       string
-	password       string
-	database       string
-	sslMode        string
-	maxConnections int
+	host               string
+	port               int
+	protocol           string
+	username           string
+	password           string
+	database           string
+	sslMode            string
+	sslRootCert        string
+	sslCert            string
+	sslKey             string
+	applicationName    string
+	maxConnections     int
+	maxIdleConnections int
+	connMaxLifetime    time.Duration
+	connMaxIdleTime    time.Duration
+	statementTimeout   time.Duration
+	connectTimeout     time.Duration
+	replicaUrls        []string
+	replicaCheck       time.Duration
+	queryTimeout       time.Duration
+	migrateOnBoot      bool
 }
 
 func (c *config) Db() IDbConfig {
-	return c.db
+	return c.current.Load().db
 }
+
+// Url builds a postgres:// connection URL. With the unix protocol the host is
+// the directory of the server socket and goes in the query string.
 func (d *db) Url() string {
-	return fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		d.host,
-		d.port,
-		d.username,
-		d.password,
-		d.database,
-		d.sslMode,
-	)
-}
-func (d *db) MaxOpenConns() int { return d.maxConnections }
+	u := &url.URL{
+		Scheme: "postgres",
+		User:   url.UserPassword(d.username, d.password),
+		Path:   "/" + d.database,
+	}
+	q := url.Values{}
+	if d.protocol == "unix" {
+		q.Set("host", d.host)
+		q.Set("port", strconv.Itoa(d.port))
+	} else {
+		u.Host = net.JoinHostPort(d.host, strconv.Itoa(d.port))
+	}
+	q.Set("sslmode", d.sslMode)
+	if d.sslRootCert != "" {
+		q.Set("sslrootcert", d.sslRootCert)
+	}
+	if d.sslCert != "" {
+		q.Set("sslcert", d.sslCert)
+		q.Set("sslkey", d.sslKey)
+	}
+	if d.applicationName != "" {
+		q.Set("application_name", d.applicationName)
+	}
+	// Unknown parameters are sent to the server as run-time settings
+	if d.statementTimeout > 0 {
+		q.Set("statement_timeout", strconv.FormatInt(d.statementTimeout.Milliseconds(), 10))
+	}
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+func (d *db) MaxOpenConns() int                   { return d.maxConnections }
+func (d *db) MaxIdleConns() int                   { return d.maxIdleConnections }
+func (d *db) ConnMaxLifetime() time.Duration      { return d.connMaxLifetime }
+func (d *db) ConnMaxIdleTime() time.Duration      { return d.connMaxIdleTime }
+func (d *db) StatementTimeout() time.Duration     { return d.statementTimeout }
+func (d *db) ApplicationName() string             { return d.applicationName }
+func (d *db) ConnectTimeout() time.Duration       { return d.connectTimeout }
+func (d *db) ReplicaUrls() []string               { return d.replicaUrls }
+func (d *db) ReplicaCheckInterval() time.Duration { return d.replicaCheck }
+func (d *db) QueryTimeout() time.Duration         { return d.queryTimeout }
+func (d *db) MigrateOnBoot() bool                 { return d.migrateOnBoot }
 
 type IJwtConfig interface {
 	SecretKey() []byte
 	AdminKey() []byte
 	ApiKey() []byte
-	AccessExpiresAt() int
-	RefreshExpiresAt() int
-	SetJwtAccessExpires(t int)
-	SetJwtRefreshExpires(t int)
+	AccessExpiresAt() time.Duration
+	RefreshExpiresAt() time.Duration
+	SetJwtAccessExpires(t time.Duration)
+	SetJwtRefreshExpires(t time.Duration)
 }
 
 type jwt struct {
 	secertKey        string
 	adminKey         string
 	apiKey           string
-	accessExpiresAt  int //sec
-	refreshExpiresAt int //sec
+	accessExpiresAt  time.Duration
+	refreshExpiresAt time.Duration
+	override         func(key, value string) error
 }
 
 func (c *config) Jwt() IJwtConfig {
-	return c.jwt
-}
-func (j *jwt) SecretKey() []byte          { return []byte(j.secertKey) }
-func (j *jwt) AdminKey() []byte           { return []byte(j.adminKey) }
-func (j *jwt) ApiKey() []byte             { return []byte(j.apiKey) }
-func (j *jwt) AccessExpiresAt() int       { return j.accessExpiresAt }
-func (j *jwt) RefreshExpiresAt() int      { return j.refreshExpiresAt }
-func (j *jwt) SetJwtAccessExpires(t int)  { j.accessExpiresAt = t }
-func (j *jwt) SetJwtRefreshExpires(t int) { j.refreshExpiresAt = t }
+	return c.current.Load().jwt
+}
+func (j *jwt) SecretKey() []byte                    { return []byte(j.secertKey) }
+func (j *jwt) AdminKey() []byte                     { return []byte(j.adminKey) }
+func (j *jwt) ApiKey() []byte                       { return []byte(j.apiKey) }
+func (j *jwt) AccessExpiresAt() time.Duration       { return j.accessExpiresAt }
+func (j *jwt) RefreshExpiresAt() time.Duration      { return j.refreshExpiresAt }
+func (j *jwt) SetJwtAccessExpires(t time.Duration)  { j.set("JWT_ACCESS_EXPIRES", t) }
+func (j *jwt) SetJwtRefreshExpires(t time.Duration) { j.set("JWT_REFRESH_EXPIRES", t) }
+
+// set overrides an expiry in the config, the change shows in the sections
+// handed out after it.
+func (j *jwt) set(key string, t time.Duration) {
+	if err := j.override(key, t.String()); err != nil {
+		logger().Error("set jwt expiry failed", "key", key, "error", err)
+	}
+}
+
+type IPasswordConfig interface {
+	MinLength() int
+	CharacterClasses() []string
+	DenyList() []string
+	Hash() string // bcrypt or argon2id
+	BcryptCost() int
+	Argon2Memory() int // bytes
+	Argon2Iterations() int
+	Argon2Threads() int
+}
+
+type password struct {
+	minLength        int
+	characterClasses []string
+	denyList         []string
+	hash             string
+	bcryptCost       int
+	argon2Memory     int
+	argon2Iterations int
+	argon2Threads    int
+}
+
+func (c *config) Password() IPasswordConfig {
+	return c.current.Load().password
+}
+func (p *password) MinLength() int             { return p.minLength }
+func (p *password) CharacterClasses() []string { return p.characterClasses }
+func (p *password) DenyList() []string         { return p.denyList }
+func (p *password) Hash() string               { return p.hash }
+func (p *password) BcryptCost() int            { return p.bcryptCost }
+func (p *password) Argon2Memory() int          { return p.argon2Memory }
+func (p *password) Argon2Iterations() int      { return p.argon2Iterations }
+func (p *password) Argon2Threads() int         { return p.argon2Threads }
+
+type IMetricsConfig interface {
+	Enabled() bool
+	Path() string
+	Username() string // basic auth is off when empty
+	Password() string
+	AllowIps() []*net.IPNet // any client may scrape when empty
+}
+
+type metrics struct {
+	enabled  bool
+	path     string
+	username string
+	password string
+	allowIps []*net.IPNet
+}
+
+func (c *config) Metrics() IMetricsConfig {
+	return c.current.Load().metrics
+}
+func (m *metrics) Enabled() bool          { return m.enabled }
+func (m *metrics) Path() string           { return m.path }
+func (m *metrics) Username() string       { return m.username }
+func (m *metrics) Password() string       { return m.password }
+func (m *metrics) AllowIps() []*net.IPNet { return m.allowIps }
+
+type ITraceConfig interface {
+	Enabled() bool
+	Exporter() string // otlp or stdout
+	ServiceName() string
+	SampleRatio() float64
+	OtlpEndpoint() string // host:port
+	OtlpInsecure() bool
+	OtlpHeaders() map[string]string
+}
+
+type trace struct {
+	enabled      bool
+	exporter     string
+	serviceName  string
+	sampleRatio  float64
+	otlpEndpoint string
+	otlpInsecure bool
+	otlpHeaders  map[string]string
+}
+
+func (c *config) Trace() ITraceConfig {
+	return c.current.Load().trace
+}
+func (t *trace) Enabled() bool                  { return t.enabled }
+func (t *trace) Exporter() string               { return t.exporter }
+func (t *trace) ServiceName() string            { return t.serviceName }
+func (t *trace) SampleRatio() float64           { return t.sampleRatio }
+func (t *trace) OtlpEndpoint() string           { return t.otlpEndpoint }
+func (t *trace) OtlpInsecure() bool             { return t.otlpInsecure }
+func (t *trace) OtlpHeaders() map[string]string { return t.otlpHeaders }
+
+type IAuditConfig interface {
+	Enabled() bool
+	Dir() string
+	MaxSize() int          // bytes
+	MaxAge() time.Duration // 0 keeps rotated files whatever their age
+	MaxFiles() int         // 0 keeps every rotated file
+	Compress() bool
+	Buffer() int      // queued entries
+	Overflow() string // block, drop_new or drop_old
+	FlushInterval() time.Duration
+}
+
+type audit struct {
+	enabled       bool
+	dir           string
+	maxSize       int
+	maxAge        time.Duration
+	maxFiles      int
+	compress      bool
+	buffer        int
+	overflow      string
+	flushInterval time.Duration
+}
+
+func (c *config) Audit() IAuditConfig {
+	return c.current.Load().audit
+}
+func (a *audit) Enabled() bool                { return a.enabled }
+func (a *audit) Dir() string                  { return a.dir }
+func (a *audit) MaxSize() int                 { return a.maxSize }
+func (a *audit) MaxAge() time.Duration        { return a.maxAge }
+func (a *audit) MaxFiles() int                { return a.maxFiles }
+func (a *audit) Compress() bool               { return a.compress }
+func (a *audit) Buffer() int                  { return a.buffer }
+func (a *audit) Overflow() string             { return a.overflow }
+func (a *audit) FlushInterval() time.Duration { return a.flushInterval }
+
+type ILogConfig interface {
+	Level() string
+	PackageLevels() map[string]string // package -> level, overrides Level
+	Format() string                   // json or text
+	RedactFields() []string
+	RedactPartial() []string
+	RedactHeaders() []string
+	Stdout() ILogSinkConfig
+	File() ILogFileConfig
+	Syslog() ILogSyslogConfig
+	Http() ILogHttpConfig
+}
+
+// ILogSinkConfig is what every log sink has, Level is the lowest level the
+// sink writes on top of the package levels.
+type ILogSinkConfig interface {
+	Enabled() bool
+	Level() string
+}
+
+type ILogFileConfig interface {
+	ILogSinkConfig
+	Dir() string
+	MaxSize() int          // bytes
+	MaxAge() time.Duration // 0 keeps rotated files whatever their age
+	MaxFiles() int         // 0 keeps every rotated file
+	Compress() bool
+}
+
+type ILogSyslogConfig interface {
+	ILogSinkConfig
+	Network() string // udp or tcp
+	Address() string // host:port
+}
+
+type ILogHttpConfig interface {
+	ILogSinkConfig
+	Url() string
+	Token() string // bearer token, empty sends none
+	BatchSize() int
+	FlushInterval() time.Duration
+	Retries() int
+	Timeout() time.Duration
+}
+
+type logSink struct {
+	enabled bool
+	level   string
+}
+
+type logFile struct {
+	logSink
+	dir      string
+	maxSize  int
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+}
+
+type logSyslog struct {
+	logSink
+	network string
+	address string
+}
+
+type logHttp struct {
+	logSink
+	url           string
+	token         string
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	timeout       time.Duration
+}
+
+func (s *logSink) Enabled() bool { return s.enabled }
+func (s *logSink) Level() string { return s.level }
+
+func (f *logFile) Dir() string           { return f.dir }
+func (f *logFile) MaxSize() int          { return f.maxSize }
+func (f *logFile) MaxAge() time.Duration { return f.maxAge }
+func (f *logFile) MaxFiles() int         { return f.maxFiles }
+func (f *logFile) Compress() bool        { return f.compress }
+
+func (s *logSyslog) Network() string { return s.network }
+func (s *logSyslog) Address() string { return s.address }
+
+func (h *logHttp) Url() string                  { return h.url }
+func (h *logHttp) Token() string                { return h.token }
+func (h *logHttp) BatchSize() int               { return h.batchSize }
+func (h *logHttp) FlushInterval() time.Duration { return h.flushInterval }
+func (h *logHttp) Retries() int                 { return h.retries }
+func (h *logHttp) Timeout() time.Duration       { return h.timeout }
+
+type logConfig struct {
+	level         string
+	packageLevels map[string]string
+	format        string
+	redactFields  []string
+	redactPartial []string
+	redactHeaders []string
+	stdout        *logSink
+	file          *logFile
+	syslog        *logSyslog
+	http          *logHttp
+}
+
+func (c *config) Log() ILogConfig {
+	return c.current.Load().log
+}
+func (l *logConfig) Level() string                    { return l.level }
+func (l *logConfig) PackageLevels() map[string]string { return l.packageLevels }
+func (l *logConfig) Format() string                   { return l.format }
+func (l *logConfig) RedactFields() []string           { return l.redactFields }
+func (l *logConfig) RedactPartial() []string          { return l.redactPartial }
+func (l *logConfig) RedactHeaders() []string          { return l.redactHeaders }
+func (l *logConfig) Stdout() ILogSinkConfig           { return l.stdout }
+func (l *logConfig) File() ILogFileConfig             { return l.file }
+func (l *logConfig) Syslog() ILogSyslogConfig         { return l.syslog }
+func (l *logConfig) Http() ILogHttpConfig             { return l.http }
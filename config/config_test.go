@@ -0,0 +1,247 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// validEnv is the smallest set of values that builds on top of the defaults.
+var validEnv = map[string]string{
+	"DB_HOST":        "localhost",
+	"DB_USERNAME":    "kwanjai",
+	"DB_DATABASE":    "kwanjai_db",
+	"JWT_SECRET_KEY": strings.Repeat("s", minSecretLength),
+	"JWT_ADMIN_KEY":  strings.Repeat("a", minSecretLength),
+	"JWT_API_KEY":    strings.Repeat("k", minSecretLength),
+}
+
+// testEnv is the defaults with validEnv and changes on top.
+func testEnv(changes map[string]string) map[string]string {
+	envMap := make(map[string]string)
+	for _, k := range keys {
+		if k.def != "" {
+			envMap[k.env] = k.def
+		}
+	}
+	for _, values := range []map[string]string{validEnv, changes} {
+		for env, v := range values {
+			envMap[env] = v
+		}
+	}
+	return envMap
+}
+
+// writeEnvFile writes the defaults, validEnv and changes to the .env file at path.
+func writeEnvFile(t *testing.T, path string, changes map[string]string) {
+	t.Helper()
+	var b strings.Builder
+	for env, v := range testEnv(changes) {
+		b.WriteString(env + "=" + v + "\n")
+	}
+	if err := os.WriteFile(path, []byte(b.String()), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBuildReportsEveryProblem(t *testing.T) {
+	_, err := build(testEnv(map[string]string{
+		"DB_HOST":        "",
+		"APP_PORT":       "http",
+		"PASSWORD_HASH":  "md5",
+		"JWT_SECRET_KEY": "short",
+		"APP_BODY_LIMIT": "lots",
+	}))
+
+	var cfgErr *ConfigError
+	if !errors.As(err, &cfgErr) {
+		t.Fatalf("err = %v, want a ConfigError", err)
+	}
+	want := map[string]string{
+		"APP_PORT":       `"http" is not an integer`,
+		"APP_BODY_LIMIT": `"lots" is not a size`,
+		"DB_HOST":        "is required",
+		"JWT_SECRET_KEY": "must be at least 32 characters",
+		"PASSWORD_HASH":  `"md5" must be one of bcrypt, argon2id`,
+	}
+	if len(cfgErr.Problems) != len(want) {
+		t.Fatalf("problems = %v, want %d of them", err, len(want))
+	}
+	for _, p := range cfgErr.Problems {
+		if reason, ok := want[p.Key]; !ok || reason != p.Reason {
+			t.Errorf("problem %s: %s, want %q", p.Key, p.Reason, reason)
+		}
+	}
+}
+
+func TestBuildChecksFeatureKeysWhenEnabled(t *testing.T) {
+	tests := []struct {
+		name    string
+		changes map[string]string
+		wantKey string
+	}{
+		{"metrics off", map[string]string{"METRICS_ENABLED": "false", "METRICS_PATH": ""}, ""},
+		{"metrics on", map[string]string{"METRICS_ENABLED": "true", "METRICS_PATH": ""}, "METRICS_PATH"},
+		{"metrics path", map[string]string{"METRICS_ENABLED": "true", "METRICS_PATH": "metrics"}, "METRICS_PATH"},
+		{"audit off", map[string]string{"AUDIT_LOG_ENABLED": "false", "AUDIT_LOG_DIR": ""}, ""},
+		{"audit on", map[string]string{"AUDIT_LOG_ENABLED": "true", "AUDIT_LOG_DIR": ""}, "AUDIT_LOG_DIR"},
+		{"syslog on", map[string]string{"LOG_SYSLOG_ENABLED": "true", "LOG_SYSLOG_ADDRESS": ""}, "LOG_SYSLOG_ADDRESS"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := build(testEnv(tt.changes))
+			if tt.wantKey == "" {
+				if err != nil {
+					t.Errorf("err = %v, want none", err)
+				}
+				return
+			}
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) || len(cfgErr.Problems) != 1 || cfgErr.Problems[0].Key != tt.wantKey {
+				t.Errorf("err = %v, want a problem with %s", err, tt.wantKey)
+			}
+		})
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{in: "1024", want: 1024},
+		{in: "100B", want: 100},
+		{in: "512KB", want: 512 << 10},
+		{in: "10mb", want: 10 << 20},
+		{in: "1GB", want: 1 << 30},
+		{in: "2MiB", want: 2 << 20},
+		{in: "1.5K", want: 1536},
+		{in: "4 M", want: 4 << 20},
+		{in: "", wantErr: true},
+		{in: "lots", wantErr: true},
+		{in: "MB", wantErr: true},
+		{in: "10TB", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseSize(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseSize(%q) err = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseSize(%q) = %d, want %d", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{in: "30", want: 30 * time.Second},
+		{in: "0", want: 0},
+		{in: "15s", want: 15 * time.Second},
+		{in: "2h30m", want: 150 * time.Minute},
+		{in: "1.5h", want: 90 * time.Minute},
+		{in: "500ms", want: 500 * time.Millisecond},
+		{in: "", wantErr: true},
+		{in: "1.5", wantErr: true},
+		{in: "10 minutes", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDuration(tt.in)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseDuration(%q) err = %v, want error %v", tt.in, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseDuration(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReloadAppliesReloadableKeysOnly(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	writeEnvFile(t, path, map[string]string{"JWT_ACCESS_EXPIRES": "1h", "APP_PORT": "3000"})
+	cfg, err := LoadConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jwt := cfg.Jwt()
+
+	writeEnvFile(t, path, map[string]string{"JWT_ACCESS_EXPIRES": "2h", "APP_PORT": "4000"})
+	if err := cfg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Jwt().AccessExpiresAt(); got != 2*time.Hour {
+		t.Errorf("access expires = %s, want the reloaded 2h", got)
+	}
+	if got := cfg.App().Port(); got != 3000 {
+		t.Errorf("port = %d, want 3000 kept until a restart", got)
+	}
+	if got := jwt.AccessExpiresAt(); got != time.Hour {
+		t.Errorf("section taken before the reload changed to %s", got)
+	}
+
+	// A bad value keeps the running config
+	writeEnvFile(t, path, map[string]string{"JWT_ACCESS_EXPIRES": "soon"})
+	if err := cfg.Reload(); err == nil {
+		t.Error("reload with a bad value succeeded")
+	}
+	if got := cfg.Jwt().AccessExpiresAt(); got != 2*time.Hour {
+		t.Errorf("access expires = %s after a failed reload, want 2h", got)
+	}
+}
+
+func TestOverride(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".env")
+	writeEnvFile(t, path, map[string]string{"JWT_ACCESS_EXPIRES": "1h"})
+	cfg, err := LoadConfig(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range map[string]string{
+		"NOT_A_KEY":          "1",
+		"APP_PORT":           "4000",
+		"JWT_ACCESS_EXPIRES": "soon",
+	} {
+		if err := cfg.Override(key, value); err == nil {
+			t.Errorf("override %s=%s succeeded, want an error", key, value)
+		}
+	}
+	if got := cfg.Jwt().AccessExpiresAt(); got != time.Hour {
+		t.Fatalf("access expires = %s after rejected overrides, want 1h", got)
+	}
+
+	if err := cfg.Override("JWT_ACCESS_EXPIRES", "3h"); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Jwt().AccessExpiresAt(); got != 3*time.Hour {
+		t.Errorf("access expires = %s, want the override 3h", got)
+	}
+
+	// The setter writes through Override
+	cfg.Jwt().SetJwtRefreshExpires(48 * time.Hour)
+	if got := cfg.Jwt().RefreshExpiresAt(); got != 48*time.Hour {
+		t.Errorf("refresh expires = %s, want the 48h set", got)
+	}
+
+	// Overrides win over the sources on reload
+	writeEnvFile(t, path, map[string]string{"JWT_ACCESS_EXPIRES": "2h", "JWT_REFRESH_EXPIRES": "1h"})
+	if err := cfg.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := cfg.Jwt().AccessExpiresAt(); got != 3*time.Hour {
+		t.Errorf("access expires = %s after reload, want the override 3h kept", got)
+	}
+	if got := cfg.Jwt().RefreshExpiresAt(); got != 48*time.Hour {
+		t.Errorf("refresh expires = %s after reload, want the 48h set kept", got)
+	}
+}
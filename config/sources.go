@@ -0,0 +1,286 @@
+package config
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// key describes one configuration value and every place it can be set from.
+type key struct {
+	env    string // name in the .env file and in the OS environment
+	yaml   string // dotted path in the YAML file, empty if not mapped
+	flag   string // command-line flag name, empty if not mapped
+	def    string
+	secret bool
+	reload bool // applied by Reload without a restart
+	usage  string
+}
+
+var keys = []*key{
+	{env: "APP_HOST", yaml: "app.host", flag: "app-host", def: "0.0.0.0", usage: "address to listen on"},
+	{env: "APP_PORT", yaml: "app.port", flag: "app-port", def: "3000", usage: "port to listen on"},
+	{env: "APP_NAME", yaml: "app.name", flag: "app-name", def: "kwanjai-shop", usage: "application name"},
+	{env: "APP_VERSION", yaml: "app.version", flag: "app-version", def: "v0.1.0", usage: "application version"},
+	{env: "APP_READ_TIMEOUT", yaml: "app.read_timeout", flag: "app-read-timeout", def: "60s", usage: "read timeout, e.g. 60s (plain integers are seconds)"},
+	{env: "APP_WRITE_TIMEOUT", yaml: "app.write_timeout", flag: "app-write-timeout", usage: "write timeout, e.g. 60s (plain integers are seconds)"},
+	{env: "APP_WRTIE_TIMEOUT", def: "60s", usage: "deprecated spelling of APP_WRITE_TIMEOUT"},
+	{env: "APP_BODY_LIMIT", yaml: "app.body_limit", flag: "app-body-limit", def: "10MB", usage: "request body limit, e.g. 10MB (plain integers are bytes)"},
+	{env: "APP_FILE_LIMIT", yaml: "app.file_limit", flag: "app-file-limit", def: "2MB", usage: "upload file limit, e.g. 2MB (plain integers are bytes)"},
+	{env: "APP_GCP_BUCKET", yaml: "app.gcp_bucket", flag: "app-gcp-bucket", usage: "GCP storage bucket"},
+	{env: "APP_CORS_ORIGINS", yaml: "app.cors_origins", flag: "app-cors-origins", def: "*", reload: true, usage: "comma separated list of allowed CORS origins"},
+	{env: "APP_RATE_LIMIT_MAX", yaml: "app.rate_limit_max", flag: "app-rate-limit-max", def: "0", reload: true, usage: "max requests per client and window, 0 disables the limiter"},
+	{env: "APP_RATE_LIMIT_WINDOW", yaml: "app.rate_limit_window", flag: "app-rate-limit-window", def: "1m", reload: true, usage: "rate limit window, e.g. 1m"},
+	{env: "APP_ERROR_FORMAT", yaml: "app.error_format", flag: "app-error-format", def: "json", reload: true, usage: "error body format: json, or problem for application/problem+json (RFC 7807)"},
+	{env: "APP_HEALTH_CHECK_TIMEOUT", yaml: "app.health_check_timeout", flag: "app-health-check-timeout", def: "2s", reload: true, usage: "deadline of each dependency check behind /readyz"},
+	{env: "APP_SHUTDOWN_DELAY", yaml: "app.shutdown_delay", flag: "app-shutdown-delay", def: "5s", usage: "how long /readyz fails before the server stops taking requests on SIGTERM, 0 stops at once"},
+	{env: "APP_SHUTDOWN_TIMEOUT", yaml: "app.shutdown_timeout", flag: "app-shutdown-timeout", def: "30s", usage: "how long in-flight requests may take to finish on shutdown before they are cancelled"},
+	{env: "DB_HOST", yaml: "db.host", flag: "db-host", usage: "database host"},
+	{env: "DB_PORT", yaml: "db.port", flag: "db-port", def: "5432", usage: "database port"},
+	{env: "DB_PROTOCOL", yaml: "db.protocol", flag: "db-protocol", def: "tcp", usage: "database protocol: tcp, or unix with DB_HOST as the socket directory"},
+	{env: "DB_USERNAME", yaml: "db.username", flag: "db-username", usage: "database username"},
+	{env: "DB_PASSWORD", yaml: "db.password", flag: "db-password", secret: true, usage: "database password"},
+	{env: "DB_DATABASE", yaml: "db.database", flag: "db-database", usage: "database name"},
+	{env: "DB_SSL_MODE", yaml: "db.ssl_mode", flag: "db-ssl-mode", def: "disable", usage: "database sslmode"},
+	{env: "DB_SSL_ROOT_CERT", yaml: "db.ssl_root_cert", flag: "db-ssl-root-cert", usage: "path to the CA certificate that signed the server certificate"},
+	{env: "DB_SSL_CERT", yaml: "db.ssl_cert", flag: "db-ssl-cert", usage: "path to the client certificate"},
+	{env: "DB_SSL_KEY", yaml: "db.ssl_key", flag: "db-ssl-key", usage: "path to the client certificate key"},
+	{env: "DB_APPLICATION_NAME", yaml: "db.application_name", flag: "db-application-name", usage: "application_name reported to the database, APP_NAME by default"},
+	{env: "DB_MAX_CONNECTIONS", yaml: "db.max_connections", flag: "db-max-connections", def: "25", usage: "max open database connections"},
+	{env: "DB_MAX_IDLE_CONNECTIONS", yaml: "db.max_idle_connections", flag: "db-max-idle-connections", def: "5", usage: "max idle database connections kept in the pool"},
+	{env: "DB_CONN_MAX_LIFETIME", yaml: "db.conn_max_lifetime", flag: "db-conn-max-lifetime", def: "30m", usage: "close connections older than this, 0 keeps them forever"},
+	{env: "DB_CONN_MAX_IDLE_TIME", yaml: "db.conn_max_idle_time", flag: "db-conn-max-idle-time", def: "5m", usage: "close connections idle for longer than this, 0 keeps them forever"},
+	{env: "DB_STATEMENT_TIMEOUT", yaml: "db.statement_timeout", flag: "db-statement-timeout", def: "0", usage: "statement_timeout set on every connection, 0 uses the server default"},
+	{env: "DB_CONNECT_TIMEOUT", yaml: "db.connect_timeout", flag: "db-connect-timeout", def: "30s", usage: "how long to keep retrying the first connection at boot"},
+	{env: "DB_REPLICA_URLS", yaml: "db.replica_urls", flag: "db-replica-urls", secret: true, usage: "comma separated postgres:// URLs of read replicas, empty sends reads to the primary"},
+	{env: "DB_REPLICA_CHECK_INTERVAL", yaml: "db.replica_check_interval", flag: "db-replica-check-interval", def: "5s", usage: "how often replicas are pinged, a failing replica gets no reads until it answers again"},
+	{env: "DB_QUERY_TIMEOUT", yaml: "db.query_timeout", flag: "db-query-timeout", def: "5s", usage: "default deadline of a single query, e.g. 5s"},
+	{env: "DB_MIGRATE_ON_BOOT", yaml: "db.migrate_on_boot", flag: "db-migrate-on-boot", def: "false", usage: "apply pending migrations when the server starts"},
+	{env: "JWT_ADMIN_KEY", yaml: "jwt.admin_key", flag: "jwt-admin-key", secret: true, usage: "admin token signing key"},
+	{env: "JWT_SECRET_KEY", yaml: "jwt.secret_key", flag: "jwt-secret-key", secret: true, usage: "token signing key"},
+	{env: "JWT_API_KEY", yaml: "jwt.api_key", flag: "jwt-api-key", secret: true, usage: "api key signing key"},
+	{env: "JWT_ACCESS_EXPIRES", yaml: "jwt.access_expires", flag: "jwt-access-expires", def: "24h", reload: true, usage: "access token lifetime, e.g. 24h (plain integers are seconds)"},
+	{env: "JWT_REFRESH_EXPIRES", yaml: "jwt.refresh_expires", flag: "jwt-refresh-expires", def: "168h", reload: true, usage: "refresh token lifetime, e.g. 168h (plain integers are seconds)"},
+	{env: "PASSWORD_MIN_LENGTH", yaml: "password.min_length", flag: "password-min-length", def: "8", reload: true, usage: "minimum password length"},
+	{env: "PASSWORD_CHARACTER_CLASSES", yaml: "password.character_classes", flag: "password-character-classes", def: "letter,digit", reload: true, usage: "comma separated classes a password must contain: lower, upper, letter, digit, symbol"},
+	{env: "PASSWORD_DENY_LIST_FILE", yaml: "password.deny_list_file", flag: "password-deny-list-file", reload: true, usage: "file of extra denied passwords, one per line, added to the built-in list"},
+	{env: "PASSWORD_HASH", yaml: "password.hash", flag: "password-hash", def: "bcrypt", reload: true, usage: "hash for new passwords: bcrypt or argon2id, older hashes are upgraded on sign in"},
+	{env: "PASSWORD_BCRYPT_COST", yaml: "password.bcrypt_cost", flag: "password-bcrypt-cost", def: "10", reload: true, usage: "bcrypt cost, 4 to 31"},
+	{env: "PASSWORD_ARGON2_MEMORY", yaml: "password.argon2_memory", flag: "password-argon2-memory", def: "64MB", reload: true, usage: "argon2id memory, e.g. 64MB"},
+	{env: "PASSWORD_ARGON2_ITERATIONS", yaml: "password.argon2_iterations", flag: "password-argon2-iterations", def: "3", reload: true, usage: "argon2id passes over the memory"},
+	{env: "PASSWORD_ARGON2_THREADS", yaml: "password.argon2_threads", flag: "password-argon2-threads", def: "2", reload: true, usage: "argon2id parallelism"},
+	{env: "METRICS_ENABLED", yaml: "metrics.enabled", flag: "metrics-enabled", def: "true", usage: "serve Prometheus metrics"},
+	{env: "METRICS_PATH", yaml: "metrics.path", flag: "metrics-path", def: "/metrics", usage: "path of the metrics endpoint"},
+	{env: "METRICS_USERNAME", yaml: "metrics.username", flag: "metrics-username", reload: true, usage: "basic auth username of the metrics endpoint, set with METRICS_PASSWORD"},
+	{env: "METRICS_PASSWORD", yaml: "metrics.password", flag: "metrics-password", secret: true, reload: true, usage: "basic auth password of the metrics endpoint"},
+	{env: "METRICS_ALLOW_IPS", yaml: "metrics.allow_ips", flag: "metrics-allow-ips", reload: true, usage: "comma separated IPs or CIDRs allowed to scrape, empty allows any"},
+	{env: "LOG_LEVEL", yaml: "log.level", flag: "log-level", def: "info", reload: true, usage: "log level: debug, info, warn or error"},
+	{env: "LOG_PACKAGE_LEVELS", yaml: "log.package_levels", flag: "log-package-levels", reload: true, usage: "comma separated per-package levels overriding LOG_LEVEL, e.g. users=debug,databases=warn"},
+	{env: "LOG_REDACT_FIELDS", yaml: "log.redact_fields", flag: "log-redact-fields", def: "password,token,*_token,*_key,secret", reload: true, usage: "comma separated fields masked in access logs, by name glob (*_token) or path ($.user.email)"},
+	{env: "LOG_REDACT_PARTIAL", yaml: "log.redact_partial", flag: "log-redact-partial", def: "email", reload: true, usage: "comma separated fields only partly masked in access logs, same syntax as LOG_REDACT_FIELDS"},
+	{env: "LOG_REDACT_HEADERS", yaml: "log.redact_headers", flag: "log-redact-headers", def: "Authorization,X-Api-Key,Cookie,Set-Cookie", reload: true, usage: "comma separated headers masked in access logs"},
+	{env: "AUDIT_LOG_ENABLED", yaml: "audit.enabled", flag: "audit-log-enabled", def: "true", usage: "save every response to the audit log"},
+	{env: "AUDIT_LOG_DIR", yaml: "audit.dir", flag: "audit-log-dir", def: "./assets/logs", usage: "audit log directory, created when missing"},
+	{env: "AUDIT_LOG_MAX_SIZE", yaml: "audit.max_size", flag: "audit-log-max-size", def: "100MB", usage: "size at which the audit log is rotated, it also rotates every day"},
+	{env: "AUDIT_LOG_MAX_AGE", yaml: "audit.max_age", flag: "audit-log-max-age", def: "720h", usage: "rotated audit logs older than this are deleted, 0 keeps them"},
+	{env: "AUDIT_LOG_MAX_FILES", yaml: "audit.max_files", flag: "audit-log-max-files", def: "30", usage: "rotated audit logs kept, 0 keeps them all"},
+	{env: "AUDIT_LOG_COMPRESS", yaml: "audit.compress", flag: "audit-log-compress", def: "true", usage: "gzip rotated audit logs"},
+	{env: "AUDIT_LOG_BUFFER", yaml: "audit.buffer", flag: "audit-log-buffer", def: "1024", usage: "entries queued for the audit log writer"},
+	{env: "AUDIT_LOG_OVERFLOW", yaml: "audit.overflow", flag: "audit-log-overflow", def: "block", usage: "when the queue is full: block, drop_new or drop_old"},
+	{env: "AUDIT_LOG_FLUSH_INTERVAL", yaml: "audit.flush_interval", flag: "audit-log-flush-interval", def: "1s", usage: "how often buffered audit entries are written to disk"},
+	{env: "LOG_STDOUT_ENABLED", yaml: "log.stdout.enabled", flag: "log-stdout-enabled", def: "true", usage: "write logs to stdout"},
+	{env: "LOG_STDOUT_LEVEL", yaml: "log.stdout.level", flag: "log-stdout-level", def: "debug", usage: "lowest level written to stdout"},
+	{env: "LOG_FILE_ENABLED", yaml: "log.file.enabled", flag: "log-file-enabled", def: "false", usage: "write logs to a rotating file"},
+	{env: "LOG_FILE_LEVEL", yaml: "log.file.level", flag: "log-file-level", def: "info", usage: "lowest level written to the log file"},
+	{env: "LOG_FILE_DIR", yaml: "log.file.dir", flag: "log-file-dir", def: "./assets/logs", usage: "log file directory, created when missing"},
+	{env: "LOG_FILE_MAX_SIZE", yaml: "log.file.max_size", flag: "log-file-max-size", def: "100MB", usage: "size at which the log file is rotated, it also rotates every day"},
+	{env: "LOG_FILE_MAX_AGE", yaml: "log.file.max_age", flag: "log-file-max-age", def: "720h", usage: "rotated log files older than this are deleted, 0 keeps them"},
+	{env: "LOG_FILE_MAX_FILES", yaml: "log.file.max_files", flag: "log-file-max-files", def: "30", usage: "rotated log files kept, 0 keeps them all"},
+	{env: "LOG_FILE_COMPRESS", yaml: "log.file.compress", flag: "log-file-compress", def: "true", usage: "gzip rotated log files"},
+	{env: "LOG_SYSLOG_ENABLED", yaml: "log.syslog.enabled", flag: "log-syslog-enabled", def: "false", usage: "send logs to syslog as RFC 5424 messages"},
+	{env: "LOG_SYSLOG_LEVEL", yaml: "log.syslog.level", flag: "log-syslog-level", def: "warn", usage: "lowest level sent to syslog"},
+	{env: "LOG_SYSLOG_NETWORK", yaml: "log.syslog.network", flag: "log-syslog-network", def: "udp", usage: "syslog transport: udp or tcp"},
+	{env: "LOG_SYSLOG_ADDRESS", yaml: "log.syslog.address", flag: "log-syslog-address", def: "localhost:514", usage: "syslog server host:port"},
+	{env: "LOG_HTTP_ENABLED", yaml: "log.http.enabled", flag: "log-http-enabled", def: "false", usage: "POST logs in batches to a collector"},
+	{env: "LOG_HTTP_LEVEL", yaml: "log.http.level", flag: "log-http-level", def: "info", usage: "lowest level sent to the collector"},
+	{env: "LOG_HTTP_URL", yaml: "log.http.url", flag: "log-http-url", usage: "collector endpoint, receives a JSON array of records"},
+	{env: "LOG_HTTP_TOKEN", yaml: "log.http.token", flag: "log-http-token", secret: true, usage: "bearer token sent to the collector"},
+	{env: "LOG_HTTP_BATCH_SIZE", yaml: "log.http.batch_size", flag: "log-http-batch-size", def: "100", usage: "records per request to the collector"},
+	{env: "LOG_HTTP_FLUSH_INTERVAL", yaml: "log.http.flush_interval", flag: "log-http-flush-interval", def: "2s", usage: "longest wait before a partial batch is sent"},
+	{env: "LOG_HTTP_RETRIES", yaml: "log.http.retries", flag: "log-http-retries", def: "3", usage: "retries of a failed batch before it is dropped"},
+	{env: "LOG_HTTP_TIMEOUT", yaml: "log.http.timeout", flag: "log-http-timeout", def: "5s", usage: "timeout of one request to the collector"},
+	{env: "LOG_FORMAT", yaml: "log.format", flag: "log-format", def: "json", usage: "stdout log format: json or text, the other sinks always write json"},
+	{env: "TRACE_ENABLED", yaml: "trace.enabled", flag: "trace-enabled", def: "false", usage: "record OpenTelemetry traces"},
+	{env: "TRACE_EXPORTER", yaml: "trace.exporter", flag: "trace-exporter", def: "otlp", usage: "where spans go: otlp or stdout"},
+	{env: "TRACE_SERVICE_NAME", yaml: "trace.service_name", flag: "trace-service-name", usage: "service.name of the spans, defaults to APP_NAME"},
+	{env: "TRACE_SAMPLE_RATIO", yaml: "trace.sample_ratio", flag: "trace-sample-ratio", def: "1", usage: "share of new traces recorded, 0 to 1, a sampled parent is always followed"},
+	{env: "TRACE_OTLP_ENDPOINT", yaml: "trace.otlp.endpoint", flag: "trace-otlp-endpoint", def: "localhost:4318", usage: "OTLP/HTTP collector host:port"},
+	{env: "TRACE_OTLP_INSECURE", yaml: "trace.otlp.insecure", flag: "trace-otlp-insecure", def: "false", usage: "send to the collector over plain HTTP"},
+	{env: "TRACE_OTLP_HEADERS", yaml: "trace.otlp.headers", flag: "trace-otlp-headers", secret: true, usage: "comma separated key=value headers sent to the collector"},
+}
+
+func lookupKey(env string) *key {
+	for _, k := range keys {
+		if k.env == env {
+			return k
+		}
+	}
+	return nil
+}
+
+// Flags holds one command-line flag per configuration key.
+type Flags struct {
+	fs     *flag.FlagSet
+	values map[string]*string
+}
+
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		fs:     fs,
+		values: make(map[string]*string),
+	}
+	for _, k := range keys {
+		if k.flag == "" {
+			continue
+		}
+		f.values[k.flag] = fs.String(k.flag, "", fmt.Sprintf("%s (%s)", k.usage, k.env))
+	}
+	return f
+}
+
+// Values returns the flags that were set on the command line, keyed by env name.
+func (f *Flags) Values() map[string]string {
+	values := make(map[string]string)
+	if f == nil {
+		return values
+	}
+	set := make(map[string]bool)
+	f.fs.Visit(func(fl *flag.Flag) { set[fl.Name] = true })
+	for _, k := range keys {
+		if k.flag != "" && set[k.flag] {
+			values[k.env] = *f.values[k.flag]
+		}
+	}
+	return values
+}
+
+// resolve merges every source in order of precedence:
+// defaults < config file < OS environment < command-line flags. The runtime
+// overrides of IConfig.Override go on top, see Reload.
+func resolve(path string, flags map[string]string) (map[string]string, error) {
+	envMap := make(map[string]string)
+	for _, k := range keys {
+		if k.def != "" {
+			envMap[k.env] = k.def
+		}
+	}
+
+	if path != "" {
+		fileMap, err := readFile(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, k := range keys {
+			if v, ok := fileMap[k.env]; ok {
+				envMap[k.env] = v
+			}
+		}
+	}
+
+	for _, k := range keys {
+		if v, ok := os.LookupEnv(k.env); ok {
+			envMap[k.env] = v
+		}
+	}
+
+	for env, v := range flags {
+		envMap[env] = v
+	}
+	return envMap, nil
+}
+
+func readFile(path string) (map[string]string, error) {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return readYaml(path)
+	default:
+		envMap, err := godotenv.Read(path)
+		if err != nil {
+			return nil, fmt.Errorf("load dotenv failed: %v", err)
+		}
+		return envMap, nil
+	}
+}
+
+func readYaml(path string) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load yaml failed: %v", err)
+	}
+
+	tree := make(map[string]any)
+	if err := yaml.Unmarshal(data, &tree); err != nil {
+		return nil, fmt.Errorf("parse yaml failed: %v", err)
+	}
+
+	flat := make(map[string]string)
+	flatten("", tree, flat)
+
+	envMap := make(map[string]string)
+	for _, k := range keys {
+		if k.yaml == "" {
+			continue
+		}
+		if v, ok := flat[k.yaml]; ok {
+			envMap[k.env] = v
+		}
+	}
+	return envMap, nil
+}
+
+func flatten(prefix string, tree map[string]any, out map[string]string) {
+	for name, v := range tree {
+		path := name
+		if prefix != "" {
+			path = prefix + "." + name
+		}
+		switch v := v.(type) {
+		case map[string]any:
+			flatten(path, v, out)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				items = append(items, fmt.Sprint(item))
+			}
+			out[path] = strings.Join(items, ",")
+		case nil:
+			out[path] = ""
+		default:
+			out[path] = fmt.Sprint(v)
+		}
+	}
+}
+
+// PrintConfig writes the effective configuration as KEY=value lines with secrets masked.
+func PrintConfig(w io.Writer, cfg IConfig) error {
+	c, ok := cfg.(*config)
+	if !ok {
+		return fmt.Errorf("config type is invalid")
+	}
+	for _, k := range keys {
+		v := c.current.Load().envMap[k.env]
+		if k.secret && v != "" {
+			v = "********"
+		}
+		if _, err := fmt.Fprintf(w, "%s=%s\n", k.env, v); err != nil {
+			return err
+		}
+	}
+	return nil
+}
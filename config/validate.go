@@ -0,0 +1,479 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const minSecretLength = 32
+
+var logLevels = []string{
+	"debug",
+	"info",
+	"warn",
+	"error",
+}
+
+var logFormats = []string{
+	"json",
+	"text",
+}
+
+var syslogNetworks = []string{
+	"udp",
+	"tcp",
+}
+
+var traceExporters = []string{
+	"otlp",
+	"stdout",
+}
+
+var auditOverflows = []string{
+	"block",
+	"drop_new",
+	"drop_old",
+}
+
+var passwordClasses = []string{
+	"lower",
+	"upper",
+	"letter",
+	"digit",
+	"symbol",
+}
+
+var passwordHashes = []string{
+	"bcrypt",
+	"argon2id",
+}
+
+var errorFormats = []string{
+	"json",
+	"problem",
+}
+
+var dbProtocols = []string{
+	"tcp",
+	"unix",
+}
+
+var sslModes = []string{
+	"disable",
+	"allow",
+	"prefer",
+	"require",
+	"verify-ca",
+	"verify-full",
+}
+
+// ConfigError lists every missing or invalid key found while loading the configuration.
+type ConfigError struct {
+	Problems []*ConfigProblem
+}
+
+type ConfigProblem struct {
+	Key    string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	msgs := make([]string, 0, len(e.Problems))
+	for _, p := range e.Problems {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", p.Key, p.Reason))
+	}
+	return fmt.Sprintf("config is invalid: %s", strings.Join(msgs, "; "))
+}
+
+// envReader reads typed values out of the env map and collects the problems
+// instead of stopping on the first one.
+type envReader struct {
+	envMap   map[string]string
+	problems []*ConfigProblem
+}
+
+func newEnvReader(envMap map[string]string) *envReader {
+	return &envReader{
+		envMap: envMap,
+	}
+}
+
+func (r *envReader) report(key, reason string) {
+	r.problems = append(r.problems, &ConfigProblem{
+		Key:    key,
+		Reason: reason,
+	})
+}
+
+func (r *envReader) string(key string) string {
+	return strings.TrimSpace(r.envMap[key])
+}
+
+func (r *envReader) requiredString(key string) string {
+	v := r.string(key)
+	if v == "" {
+		r.report(key, "is required")
+	}
+	return v
+}
+
+// requiredWhen reports key, whose value is v, as missing when the feature
+// turned on by enabledKey is enabled.
+func (r *envReader) requiredWhen(enabled bool, enabledKey, key, v string) {
+	if enabled && v == "" {
+		r.report(key, fmt.Sprintf("is required when %s is true", enabledKey))
+	}
+}
+
+func (r *envReader) positiveInt(key string) int {
+	v := r.string(key)
+	if v == "" {
+		r.report(key, "is required")
+		return 0
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		r.report(key, fmt.Sprintf("%q is not an integer", v))
+		return 0
+	}
+	if i <= 0 {
+		r.report(key, fmt.Sprintf("must be positive, got %d", i))
+		return 0
+	}
+	return i
+}
+
+// firstString returns the first of keys that is set, so a renamed key can
+// still fall back to its old spelling.
+func (r *envReader) firstString(keys ...string) (string, string) {
+	for _, key := range keys {
+		if v := r.string(key); v != "" {
+			return key, v
+		}
+	}
+	return keys[0], ""
+}
+
+// duration accepts a Go duration string (15s, 2h) or a plain integer of seconds.
+func (r *envReader) duration(keys ...string) time.Duration {
+	key, v := r.firstString(keys...)
+	if v == "" {
+		r.report(key, "is required")
+		return 0
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		r.report(key, err.Error())
+		return 0
+	}
+	if d <= 0 {
+		r.report(key, fmt.Sprintf("must be positive, got %s", d))
+		return 0
+	}
+	return d
+}
+
+// optionalDuration is duration for settings where an empty value or 0 turns
+// the feature off.
+func (r *envReader) optionalDuration(key string) time.Duration {
+	v := r.string(key)
+	if v == "" {
+		return 0
+	}
+	d, err := parseDuration(v)
+	if err != nil {
+		r.report(key, err.Error())
+		return 0
+	}
+	if d < 0 {
+		r.report(key, fmt.Sprintf("must not be negative, got %s", d))
+		return 0
+	}
+	return d
+}
+
+// size accepts a size with a unit (512KB, 10MB, 1GB) or a plain integer of bytes.
+func (r *envReader) size(key string) int {
+	v := r.string(key)
+	if v == "" {
+		r.report(key, "is required")
+		return 0
+	}
+	b, err := parseSize(v)
+	if err != nil {
+		r.report(key, err.Error())
+		return 0
+	}
+	if b <= 0 {
+		r.report(key, fmt.Sprintf("must be positive, got %d", b))
+		return 0
+	}
+	return b
+}
+
+func (r *envReader) secret(key string) string {
+	v := r.string(key)
+	if v == "" {
+		r.report(key, "is required")
+		return v
+	}
+	if len(v) < minSecretLength {
+		r.report(key, fmt.Sprintf("must be at least %d characters", minSecretLength))
+	}
+	return v
+}
+
+func (r *envReader) nonNegativeInt(key string) int {
+	v := r.string(key)
+	if v == "" {
+		return 0
+	}
+	i, err := strconv.Atoi(v)
+	if err != nil {
+		r.report(key, fmt.Sprintf("%q is not an integer", v))
+		return 0
+	}
+	if i < 0 {
+		r.report(key, fmt.Sprintf("must not be negative, got %d", i))
+		return 0
+	}
+	return i
+}
+
+func (r *envReader) bool(key string) bool {
+	v := r.string(key)
+	if v == "" {
+		return false
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		r.report(key, fmt.Sprintf("%q is not a boolean", v))
+		return false
+	}
+	return b
+}
+
+// intBetween is positiveInt bounded to [min, max].
+func (r *envReader) intBetween(key string, min, max int) int {
+	i := r.positiveInt(key)
+	if i != 0 && (i < min || i > max) {
+		r.report(key, fmt.Sprintf("must be between %d and %d, got %d", min, max, i))
+		return 0
+	}
+	return i
+}
+
+// ratio is a fraction between 0 and 1.
+func (r *envReader) ratio(key string) float64 {
+	v := r.string(key)
+	if v == "" {
+		r.report(key, "is required")
+		return 0
+	}
+	f, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		r.report(key, fmt.Sprintf("%q is not a number", v))
+		return 0
+	}
+	if f < 0 || f > 1 {
+		r.report(key, fmt.Sprintf("must be between 0 and 1, got %s", v))
+		return 0
+	}
+	return f
+}
+
+// listOf is list where every item must be one of options.
+func (r *envReader) listOf(key string, options []string) []string {
+	items := r.list(key)
+	for _, item := range items {
+		if !slices.Contains(options, item) {
+			r.report(key, fmt.Sprintf("%q must be one of %s", item, strings.Join(options, ", ")))
+		}
+	}
+	return items
+}
+
+// lines reads the file named by key, one item per line. Blank lines and
+// lines starting with # are skipped, an unset key gives no lines.
+func (r *envReader) lines(key string) []string {
+	path := r.string(key)
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		r.report(key, fmt.Sprintf("read %s failed: %v", path, err))
+		return nil
+	}
+	items := make([]string, 0)
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			items = append(items, line)
+		}
+	}
+	return items
+}
+
+// list splits a comma separated value and drops the empty items.
+func (r *envReader) list(key string) []string {
+	items := make([]string, 0)
+	for _, item := range strings.Split(r.string(key), ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// patterns is list where every item must be a valid path.Match pattern,
+// a leading $. is allowed.
+func (r *envReader) patterns(key string) []string {
+	items := r.list(key)
+	for _, item := range items {
+		for _, segment := range strings.Split(strings.TrimPrefix(item, "$."), ".") {
+			if _, err := path.Match(segment, ""); err != nil || segment == "" {
+				r.report(key, fmt.Sprintf("%q is not a valid pattern", item))
+				break
+			}
+		}
+	}
+	return items
+}
+
+// networks reads a list of IPs and CIDRs, a plain IP is a network of one address.
+func (r *envReader) networks(key string) []*net.IPNet {
+	networks := make([]*net.IPNet, 0)
+	for _, item := range r.list(key) {
+		if !strings.Contains(item, "/") {
+			ip := net.ParseIP(item)
+			if ip == nil {
+				r.report(key, fmt.Sprintf("%q is not an IP or CIDR", item))
+				continue
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, network, err := net.ParseCIDR(item)
+		if err != nil {
+			r.report(key, fmt.Sprintf("%q is not an IP or CIDR", item))
+			continue
+		}
+		networks = append(networks, network)
+	}
+	return networks
+}
+
+// levels reads name=level pairs, every level must be one of options.
+func (r *envReader) levels(key string, options []string) map[string]string {
+	levels := make(map[string]string)
+	for _, item := range r.list(key) {
+		name, level, ok := strings.Cut(item, "=")
+		name, level = strings.TrimSpace(name), strings.TrimSpace(level)
+		if !ok || name == "" {
+			r.report(key, fmt.Sprintf("%q is not a name=level pair", item))
+			continue
+		}
+		if !slices.Contains(options, level) {
+			r.report(key, fmt.Sprintf("%q must be one of %s", level, strings.Join(options, ", ")))
+			continue
+		}
+		levels[name] = level
+	}
+	return levels
+}
+
+// pairs reads key=value pairs. The values may be secrets, so a bad item is
+// reported by position only.
+func (r *envReader) pairs(key string) map[string]string {
+	pairs := make(map[string]string)
+	for i, item := range r.list(key) {
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			r.report(key, fmt.Sprintf("item %d is not a key=value pair", i+1))
+			continue
+		}
+		pairs[name] = strings.TrimSpace(value)
+	}
+	return pairs
+}
+
+func (r *envReader) oneOf(key string, options []string) string {
+	v := r.string(key)
+	if v == "" {
+		r.report(key, "is required")
+		return v
+	}
+	for _, o := range options {
+		if v == o {
+			return v
+		}
+	}
+	r.report(key, fmt.Sprintf("%q must be one of %s", v, strings.Join(options, ", ")))
+	return v
+}
+
+func (r *envReader) err() error {
+	if len(r.problems) == 0 {
+		return nil
+	}
+	return &ConfigError{
+		Problems: r.problems,
+	}
+}
+
+func parseDuration(v string) (time.Duration, error) {
+	if sec, err := strconv.Atoi(v); err == nil {
+		return time.Duration(sec) * time.Second, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a duration", v)
+	}
+	return d, nil
+}
+
+// Sizes use binary multiples, 1KB is 1024 bytes.
+var sizeUnits = []struct {
+	suffix string
+	factor int
+}{
+	{"KIB", 1 << 10},
+	{"MIB", 1 << 20},
+	{"GIB", 1 << 30},
+	{"KB", 1 << 10},
+	{"MB", 1 << 20},
+	{"GB", 1 << 30},
+	{"K", 1 << 10},
+	{"M", 1 << 20},
+	{"G", 1 << 30},
+	{"B", 1},
+}
+
+func parseSize(v string) (int, error) {
+	if b, err := strconv.Atoi(v); err == nil {
+		return b, nil
+	}
+	upper := strings.ToUpper(strings.TrimSpace(v))
+	for _, u := range sizeUnits {
+		if !strings.HasSuffix(upper, u.suffix) {
+			continue
+		}
+		n, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(upper, u.suffix)), 64)
+		if err != nil {
+			break
+		}
+		return int(n * float64(u.factor)), nil
+	}
+	return 0, fmt.Errorf("%q is not a size", v)
+}
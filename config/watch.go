@@ -0,0 +1,79 @@
+package config
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// Editors often write a file in several steps, wait for them to settle before reloading.
+const reloadDebounce = 200 * time.Millisecond
+
+// Watch reloads cfg whenever its config file changes or the process receives
+// SIGHUP, and calls onReload after every successful reload. It blocks until ctx is done.
+func Watch(ctx context.Context, cfg IConfig, onReload func(IConfig)) error {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	path := ""
+	if c, ok := cfg.(*config); ok {
+		path = c.path
+	}
+	if path != "" {
+		watcher, err := fsnotify.NewWatcher()
+		if err != nil {
+			return err
+		}
+		defer watcher.Close()
+
+		// Watch the directory, the file itself may be replaced rather than written
+		if err := watcher.Add(filepath.Dir(path)); err != nil {
+			return err
+		}
+		events = watcher.Events
+		errs = watcher.Errors
+	}
+
+	reload := func(reason string) {
+		if err := cfg.Reload(); err != nil {
+			logger().Error("reload failed, keeping the running config", "reason", reason, "error", err)
+			return
+		}
+		logger().Info("reloaded", "reason", reason)
+		if onReload != nil {
+			onReload(cfg)
+		}
+	}
+
+	debounce := time.NewTimer(reloadDebounce)
+	debounce.Stop()
+	defer debounce.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-hup:
+			reload("SIGHUP")
+		case e := <-events:
+			if filepath.Clean(e.Name) != filepath.Clean(path) {
+				continue
+			}
+			if e.Has(fsnotify.Write) || e.Has(fsnotify.Create) || e.Has(fsnotify.Rename) {
+				debounce.Reset(reloadDebounce)
+			}
+		case <-debounce.C:
+			reload("file change")
+		case err := <-errs:
+			logger().Error("watch failed", "path", path, "error", err)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package entities
+
+import (
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"net/http"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	MIMEApplicationProblemJSON = "application/problem+json"
+
+	problemDetailsKey = "problemDetails"
+)
+
+// ProblemDetails is the RFC 7807 rendering of an ErrorResponse. request_id,
+// trace_id and code are extension members with the same meaning as in ErrorResponse.
+type ProblemDetails struct {
+	Type      string                  `json:"type"`
+	Title     string                  `json:"title"`
+	Status    int                     `json:"status"`
+	Detail    string                  `json:"detail,omitempty"`
+	Instance  string                  `json:"instance,omitempty"`
+	RequestId string                  `json:"request_id"`
+	TraceId   string                  `json:"trace_id,omitempty"`
+	Code      string                  `json:"code"`
+	Errors    []*apperrors.FieldError `json:"errors,omitempty"`
+}
+
+// UseProblemDetails makes the error responses of c render as problem+json.
+func UseProblemDetails(c *fiber.Ctx) {
+	c.Locals(problemDetailsKey, true)
+}
+
+// AcceptsProblemDetails reports whether the client asked for problem+json.
+func AcceptsProblemDetails(c *fiber.Ctx) bool {
+	return strings.Contains(c.Get(fiber.HeaderAccept), MIMEApplicationProblemJSON)
+}
+
+// SetErrorFormat makes the error responses of c render as problem+json when
+// format, the configured one, is "problem" or the client asked for it.
+func SetErrorFormat(c *fiber.Ctx, format string) {
+	if format == "problem" || AcceptsProblemDetails(c) {
+		UseProblemDetails(c)
+	}
+}
+
+func wantsProblemDetails(c *fiber.Ctx) bool {
+	on, _ := c.Locals(problemDetailsKey).(bool)
+	return on
+}
+
+func newProblemDetails(c *fiber.Ctx, status int, res *ErrorResponse) *ProblemDetails {
+	return &ProblemDetails{
+		// about:blank says the HTTP status is all the semantics there is
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    status,
+		Detail:    res.Msg,
+		Instance:  c.OriginalURL(),
+		RequestId: res.RequestId,
+		TraceId:   res.TraceId,
+		Code:      res.Code,
+		Errors:    res.Errors,
+	}
+}
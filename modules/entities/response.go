@@ -1,14 +1,19 @@
 package entities
 
 import (
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
 	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/utils"
+	"log/slog"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type IResponse interface {
 	Success(code int, data any) IResponse
-	Error(code int, tractId, msg string) IResponse
+	Error(code int, errCode, msg string) IResponse
+	Fail(errCode string, err error) IResponse
 	Res() error
 }
 
@@ -20,9 +25,15 @@ type Response struct {
 	IsError    bool
 }
 
+// ErrorResponse carries the request id, the one in X-Request-ID, and the
+// trace id when there is a trace, so a client's report can be matched with
+// the logs and the trace. The handler error code is code.
 type ErrorResponse struct {
-	TraceId string `json:"trace_id"`
-	Msg     string `json:"message"`
+	RequestId string                  `json:"request_id"`
+	TraceId   string                  `json:"trace_id,omitempty"`
+	Code      string                  `json:"code"`
+	Msg       string                  `json:"message"`
+	Errors    []*apperrors.FieldError `json:"errors,omitempty"`
 }
 
 func NewResponse(c *fiber.Ctx) IResponse {
@@ -37,17 +48,48 @@ func (r *Response) Success(code int, data any) IResponse {
 	kwanjailogger.InitKwanjaiLogger(r.Context, &r.Data, code).Print().Save()
 	return r
 }
-func (r *Response) Error(code int, tractId, msg string) IResponse {
-	r.StatusCode = code
-	r.ErrorRes = &ErrorResponse{
-		TraceId: tractId,
-		Msg:     msg,
+func (r *Response) Error(code int, errCode, msg string) IResponse {
+	return r.error(code, &ErrorResponse{
+		Code: errCode,
+		Msg:  msg,
+	})
+}
+
+// Fail responds with the status mapped from err's kind. A code carried by
+// err wins over errCode. The client only gets the safe message, an
+// internal error is logged with its cause.
+func (r *Response) Fail(errCode string, err error) IResponse {
+	code := apperrors.CodeOf(err, errCode)
+	if apperrors.KindOf(err) == apperrors.Internal {
+		kwanjailogger.For(slog.Default(), "http").ErrorContext(r.Context.UserContext(), "request failed",
+			"code", code,
+			"error", err,
+		)
 	}
+	return r.error(apperrors.Status(err), &ErrorResponse{
+		Code:   code,
+		Msg:    apperrors.MessageOf(err),
+		Errors: apperrors.FieldsOf(err),
+	})
+}
+
+func (r *Response) error(code int, res *ErrorResponse) IResponse {
+	res.RequestId = utils.RequestId(r.Context)
+	res.TraceId = kwanjaitrace.TraceId(r.Context.UserContext())
+	r.StatusCode = code
+	r.ErrorRes = res
 	r.IsError = true
-	kwanjailogger.InitKwanjaiLogger(r.Context, &r.ErrorRes, code).Print()
+	kwanjailogger.InitKwanjaiLogger(r.Context, &r.ErrorRes, code).Print().Save()
 	return r
 }
+
 func (r *Response) Res() error {
+	if r.IsError && wantsProblemDetails(r.Context) {
+		return r.Context.Status(r.StatusCode).JSON(
+			newProblemDetails(r.Context, r.StatusCode, r.ErrorRes),
+			MIMEApplicationProblemJSON,
+		)
+	}
 	return r.Context.Status(r.StatusCode).JSON(func() any {
 		if r.IsError {
 			return &r.ErrorRes
@@ -0,0 +1,66 @@
+//go:build linux || darwin
+
+package middlewaresHandlers
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"time"
+)
+
+// watchDisconnect cancels once the client closes conn, until stop is called.
+// fasthttp has read the whole request before the handler runs, so the socket
+// is peeked rather than read and a pipelined request stays where it is. A
+// connection that cannot be watched, such as a TLS one, is never cancelled.
+//
+// stop clears the read deadline, fasthttp sets its own before reading the
+// next request.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	sc, ok := conn.(syscall.Conn)
+	if !ok {
+		return func() {}
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return func() {}
+	}
+	// The read timeout covers reading the request, not the handler
+	if err := conn.SetReadDeadline(time.Time{}); err != nil {
+		return func() {}
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		var closed bool
+		buf := make([]byte, 1)
+		err := raw.Read(func(fd uintptr) bool {
+			n, _, err := syscall.Recvfrom(int(fd), buf, syscall.MSG_PEEK|syscall.MSG_DONTWAIT)
+			switch {
+			case errors.Is(err, syscall.EAGAIN), errors.Is(err, syscall.EINTR):
+				// Nothing to read yet, wait until there is
+				return false
+			case err != nil:
+				closed = true
+			case n == 0:
+				// EOF, the client went away
+				closed = true
+			}
+			// Otherwise the client sent more, a pipelined request, and
+			// there is no telling if it is still there after it
+			return true
+		})
+		if err == nil && closed {
+			cancel()
+		}
+	}()
+
+	return func() {
+		// Wake the watcher up with a deadline in the past
+		_ = conn.SetReadDeadline(time.Unix(1, 0))
+		<-done
+		_ = conn.SetReadDeadline(time.Time{})
+	}
+}
@@ -0,0 +1,14 @@
+//go:build !linux && !darwin
+
+package middlewaresHandlers
+
+import (
+	"context"
+	"net"
+)
+
+// watchDisconnect does not watch conn on this platform, a request runs until
+// the write timeout or its own query timeout.
+func watchDisconnect(conn net.Conn, cancel context.CancelFunc) (stop func()) {
+	return func() {}
+}
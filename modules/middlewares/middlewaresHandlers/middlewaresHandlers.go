@@ -1,16 +1,32 @@
 package middlewaresHandlers
 
 import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
 	"github/Panyakorn4/kwanjai-shop-tutorial/config"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/entities"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/middlewares/middlewaresUsecases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
 	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaiauth"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaimetrics"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
 	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/utils"
+	"log/slog"
+	"net"
+	"runtime/debug"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
-	"github.com/gofiber/fiber/v2/middleware/logger"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	fiberutils "github.com/gofiber/fiber/v2/utils"
 )
 
 type middlewareHandlersErrCode string
@@ -20,12 +36,23 @@ const (
 	jwtAuthErr       middlewareHandlersErrCode = "middlware-002"
 	paramsCheckErr   middlewareHandlersErrCode = "middlware-003"
 	authorizationErr middlewareHandlersErrCode = "middlware-004"
+	rateLimitErr     middlewareHandlersErrCode = "middlware-005"
+	recoverErr       middlewareHandlersErrCode = "middlware-006"
+	metricsGuardErr  middlewareHandlersErrCode = "middlware-007"
 )
 
 type IMiddlewaresHandlers interface {
+	RequestId() fiber.Handler
+	ErrorFormat() fiber.Handler
+	Recover() fiber.Handler
 	Core() fiber.Handler
+	RequestContext(abort context.Context) fiber.Handler
+	RateLimit() fiber.Handler
 	RouterCheck() fiber.Handler
 	Logger() fiber.Handler
+	Metrics() fiber.Handler
+	MetricsGuard() fiber.Handler
+	Trace() fiber.Handler
 	JwtAuth() fiber.Handler
 	ParamsCheck() fiber.Handler
 	Authorize(expectRoleId ...int) fiber.Handler
@@ -33,20 +60,30 @@ type IMiddlewaresHandlers interface {
 
 type middlewaresHandlers struct {
 	cfg                 config.IConfig
+	logger              *slog.Logger
 	middlewaresUsecases middlewaresUsecases.IMiddlewaresUsecases
 }
 
-func MiddlewaresHandlers(cfg config.IConfig, middlewaresUsecases middlewaresUsecases.IMiddlewaresUsecases) IMiddlewaresHandlers {
+func MiddlewaresHandlers(cfg config.IConfig, logger *slog.Logger, middlewaresUsecases middlewaresUsecases.IMiddlewaresUsecases) IMiddlewaresHandlers {
 	return &middlewaresHandlers{
 		cfg:                 cfg,
+		logger:              kwanjailogger.For(logger, "middlewares"),
 		middlewaresUsecases: middlewaresUsecases,
 	}
 }
 
 func (h *middlewaresHandlers) Core() fiber.Handler {
 	return cors.New(cors.Config{
-		Next:             cors.ConfigDefault.Next,
-		AllowOrigins:     "*",
+		Next: cors.ConfigDefault.Next,
+		// Read the origins on every request so a config reload takes effect at once
+		AllowOriginsFunc: func(origin string) bool {
+			for _, o := range h.cfg.App().CorsOrigins() {
+				if o == "*" || o == origin {
+					return true
+				}
+			}
+			return false
+		},
 		AllowMethods:     "GET,POST,HEAD,PUT,DELETE,PATCH",
 		AllowHeaders:     "",
 		AllowCredentials: false,
@@ -54,46 +91,301 @@ func (h *middlewaresHandlers) Core() fiber.Handler {
 		MaxAge:           0,
 	})
 }
+
+// RequestContext bounds the user context by the write timeout, once the
+// response can no longer be written the queries behind it are cancelled too.
+// It also opens the database session that keeps reads after a write on the primary.
+// The requests still running when abort is done are cancelled. The fasthttp
+// context is not used for that, it is done as soon as a shutdown begins and
+// would cut off the requests the shutdown is waiting for. A client that
+// disconnects cancels its request as well.
+func (h *middlewaresHandlers) RequestContext(abort context.Context) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx := databases.WithSession(c.UserContext())
+		var cancel context.CancelFunc
+		if timeout := h.cfg.App().WriteTimeout(); timeout > 0 {
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+		} else {
+			ctx, cancel = context.WithCancel(ctx)
+		}
+		defer cancel()
+		stop := context.AfterFunc(abort, cancel)
+		defer stop()
+		stopWatch := watchDisconnect(c.Context().Conn(), cancel)
+		defer stopWatch()
+
+		c.SetUserContext(ctx)
+		return c.Next()
+	}
+}
+
+// probePaths are never rate limited, an orchestrator whose probe got a 429
+// would restart a busy server or take it out of rotation.
+var probePaths = map[string]bool{
+	"/healthz": true,
+	"/readyz":  true,
+}
+
+func (h *middlewaresHandlers) RateLimit() fiber.Handler {
+	var (
+		mu      sync.Mutex
+		max     int
+		window  time.Duration
+		handler fiber.Handler
+	)
+	// The limiter cannot change its settings, so build a new one whenever the
+	// config is reloaded with a different limit. Counters restart at that point.
+	current := func() fiber.Handler {
+		mu.Lock()
+		defer mu.Unlock()
+
+		m, w := h.cfg.App().RateLimitMax(), h.cfg.App().RateLimitWindow()
+		if handler == nil || m != max || w != window {
+			max, window = m, w
+			handler = limiter.New(limiter.Config{
+				Max:        max,
+				Expiration: window,
+				LimitReached: func(c *fiber.Ctx) error {
+					return entities.NewResponse(c).Error(
+						fiber.ErrTooManyRequests.Code,
+						string(rateLimitErr),
+						"too many requests",
+					).Res()
+				},
+			})
+		}
+		return handler
+	}
+
+	return func(c *fiber.Ctx) error {
+		if h.cfg.App().RateLimitMax() == 0 || probePaths[strings.TrimSuffix(c.Path(), "/")] {
+			return c.Next()
+		}
+		return current()(c)
+	}
+}
+
+// RouterCheck runs after every route, so the only error left for it is
+// Fiber's own 404, or 405 when the path exists under another method.
 func (h *middlewaresHandlers) RouterCheck() fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		return entities.NewResponse(c).Error(
-			fiber.ErrNotFound.Code,
-			string(routerCheckErr),
-			"router not found",
-		).Res()
+		err := c.Next()
+		var fe *fiber.Error
+		if !errors.As(err, &fe) {
+			return err
+		}
+		if fe.Code == fiber.StatusMethodNotAllowed || fe.Code == fiber.StatusNotFound {
+			c.Locals(unmatchedKey, true)
+		}
+		switch fe.Code {
+		case fiber.StatusMethodNotAllowed:
+			return entities.NewResponse(c).Error(
+				fiber.ErrMethodNotAllowed.Code,
+				string(routerCheckErr),
+				"method not allowed",
+			).Res()
+		case fiber.StatusNotFound:
+			return entities.NewResponse(c).Error(
+				fiber.ErrNotFound.Code,
+				string(routerCheckErr),
+				"router not found",
+			).Res()
+		}
+		return err
+	}
+}
+
+// unmatchedKey marks a request no route matched, its route is then the last
+// middleware it went through.
+const unmatchedKey = "unmatched"
+
+// routeOf is the route template of c, or "unmatched", so raw paths never
+// become a metric label or a span name.
+func routeOf(c *fiber.Ctx) string {
+	if unmatched, _ := c.Locals(unmatchedKey).(bool); unmatched {
+		return "unmatched"
+	}
+	return c.Route().Path
+}
+
+// RequestId assigns the request id before anything can log or fail, and
+// starts the request fields every log record of the request carries.
+func (h *middlewaresHandlers) RequestId() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.SetUserContext(kwanjailogger.WithFields(c.UserContext(), &kwanjailogger.Fields{
+			RequestId: utils.RequestId(c),
+			Method:    c.Method(),
+			Route:     fiberutils.CopyString(c.Path()),
+		}))
+		return c.Next()
+	}
+}
+
+// ErrorFormat picks problem+json error bodies when the config asks for them
+// or the client accepts them, the plain ErrorResponse otherwise.
+func (h *middlewaresHandlers) ErrorFormat() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		entities.SetErrorFormat(c, h.cfg.App().ErrorFormat())
+		return c.Next()
+	}
+}
+
+// Recover turns a panic into an internal error for the error handler and
+// logs the stack, the panic value never reaches the client.
+func (h *middlewaresHandlers) Recover() fiber.Handler {
+	return func(c *fiber.Ctx) (err error) {
+		defer func() {
+			if r := recover(); r != nil {
+				h.logger.ErrorContext(c.UserContext(), "panic recovered",
+					"panic", fmt.Sprint(r),
+					"stack", string(debug.Stack()),
+				)
+				err = apperrors.New(apperrors.Internal, "internal server error").WithCode(string(recoverErr))
+			}
+		}()
+		return c.Next()
 	}
 }
 
+// renderError hands err to the error handler, like Fiber's own logger does,
+// for the middlewares that need the status of the response. The middlewares
+// around them then see no error.
+func renderError(c *fiber.Ctx, err error) {
+	if err == nil {
+		return
+	}
+	if err := c.App().ErrorHandler(c, err); err != nil {
+		_ = c.SendStatus(fiber.StatusInternalServerError)
+	}
+}
+
+// Logger writes one record per request once the response is known, it sits
+// outside Recover so a request that panicked is logged too.
 func (h *middlewaresHandlers) Logger() fiber.Handler {
-	return logger.New(logger.Config{
-		Format:     "${time} [${ip}] ${status} - ${method} ${path}\n",
-		TimeFormat: "02/01/2006",
-		TimeZone:   "Bangkok/Asia",
-	})
+	logger := kwanjailogger.For(h.logger, "http")
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		renderError(c, c.Next())
+		logger.InfoContext(c.UserContext(), "request completed",
+			"ip", c.IP(),
+			"status", c.Response().StatusCode(),
+			"latency", time.Since(start),
+		)
+		return nil
+	}
+}
+
+// Metrics counts and times every request by its route template, requests
+// no route matched share the "unmatched" route.
+func (h *middlewaresHandlers) Metrics() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if !h.cfg.Metrics().Enabled() {
+			return c.Next()
+		}
+		start := time.Now()
+		renderError(c, c.Next())
+		kwanjaimetrics.ObserveRequest(routeOf(c), c.Method(), c.Response().StatusCode(), time.Since(start))
+		return nil
+	}
+}
+
+// Trace wraps the whole request in a server span, the outermost middleware so
+// the logs of every other one carry the trace id.
+func (h *middlewaresHandlers) Trace() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, span := kwanjaitrace.StartRequest(c)
+		c.SetUserContext(ctx)
+		renderError(c, c.Next())
+		kwanjaitrace.EndRequest(span, c.Method(), routeOf(c), c.Response().StatusCode())
+		return nil
+	}
+}
+
+// MetricsGuard lets a scrape through when the client IP is allowed and the
+// basic auth credentials match, each check only applies when configured.
+func (h *middlewaresHandlers) MetricsGuard() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		cfg := h.cfg.Metrics()
+		if allow := cfg.AllowIps(); len(allow) > 0 {
+			ip := net.ParseIP(c.IP())
+			allowed := false
+			for _, network := range allow {
+				if ip != nil && network.Contains(ip) {
+					allowed = true
+					break
+				}
+			}
+			if !allowed {
+				return entities.NewResponse(c).Error(
+					fiber.ErrForbidden.Code,
+					string(metricsGuardErr),
+					"no permission to access",
+				).Res()
+			}
+		}
+		if cfg.Username() != "" {
+			username, password, ok := basicAuth(c.Get(fiber.HeaderAuthorization))
+			if !ok ||
+				subtle.ConstantTimeCompare([]byte(username), []byte(cfg.Username())) != 1 ||
+				subtle.ConstantTimeCompare([]byte(password), []byte(cfg.Password())) != 1 {
+				c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="metrics"`)
+				return entities.NewResponse(c).Error(
+					fiber.ErrUnauthorized.Code,
+					string(metricsGuardErr),
+					"no permission to access",
+				).Res()
+			}
+		}
+		return c.Next()
+	}
+}
+
+func basicAuth(header string) (string, string, bool) {
+	encoded, ok := strings.CutPrefix(header, "Basic ")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+	return strings.Cut(string(decoded), ":")
 }
 
+// JwtAuth ends its span before moving on, so the span only covers the token
+// checks and not the rest of the request.
 func (h *middlewaresHandlers) JwtAuth() fiber.Handler {
 	return func(c *fiber.Ctx) error {
+		ctx, span := kwanjaitrace.Start(c.UserContext(), "middleware.JwtAuth")
 		token := strings.TrimPrefix(c.Get("Authorization"), "Bearer ")
 		result, err := kwanjaiauth.ParseToken(h.cfg.Jwt(), token)
 		if err != nil {
-			return entities.NewResponse(c).Error(
-				fiber.ErrUnauthorized.Code,
-				string(jwtAuthErr),
-				err.Error(),
-			).Res()
+			kwanjaitrace.End(span, err)
+			return entities.NewResponse(c).Fail(string(jwtAuthErr), err).Res()
 		}
 
 		claims := result.Claims
-		if !h.middlewaresUsecases.FindAccessToken(claims.Id, token) {
+		found, err := h.middlewaresUsecases.FindAccessToken(ctx, claims.Id, token)
+		if err != nil {
+			kwanjaimetrics.TokenRejected("lookup_error")
+			kwanjaitrace.End(span, err)
+			return entities.NewResponse(c).Fail(string(jwtAuthErr), err).Res()
+		}
+		if !found {
+			kwanjaimetrics.TokenRejected("revoked")
+			kwanjaitrace.End(span, errors.New("access token is revoked"))
 			return entities.NewResponse(c).Error(
 				fiber.ErrUnauthorized.Code,
 				string(jwtAuthErr),
 				"no permission to access",
 			).Res()
 		}
+		kwanjaitrace.End(span, nil)
 
 		// Set UserId
+		if f := kwanjailogger.FieldsFrom(c.UserContext()); f != nil {
+			f.UserId = claims.Id
+		}
 		c.Locals("userId", claims.Id)
 		c.Locals("userRoleId", claims.RoleId)
 		return c.Next()
@@ -124,13 +416,11 @@ func (h *middlewaresHandlers) Authorize(expectRoleId ...int) fiber.Handler {
 				"user_id is not int type",
 			).Res()
 		}
-		roles, err := h.middlewaresUsecases.FindRole()
+		ctx, span := kwanjaitrace.Start(c.UserContext(), "middleware.Authorize")
+		roles, err := h.middlewaresUsecases.FindRole(ctx)
+		kwanjaitrace.End(span, err)
 		if err != nil {
-			return entities.NewResponse(c).Error(
-				fiber.ErrInternalServerError.Code,
-				string(authorizationErr),
-				err.Error(),
-			).Res()
+			return entities.NewResponse(c).Fail(string(authorizationErr), err).Res()
 		}
 
 		sum := 0
@@ -1,28 +1,36 @@
 package middlewaresRepositories
 
 import (
-	"fmt"
+	"context"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/middlewares"
-
-	"github.com/jmoiron/sqlx"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
 )
 
 type IMiddlewaresRepository interface {
-	FindAccessToken(userId, accessToken string) bool
-	FindRole() ([]*middlewares.Role, error)
+	FindAccessToken(ctx context.Context, userId, accessToken string) (bool, error)
+	FindRole(ctx context.Context) ([]*middlewares.Role, error)
 }
 
 type middlewaresRepository struct {
-	db *sqlx.DB
+	cfg config.IDbConfig
+	db  databases.IRouter
 }
 
-func MiddlewaresRepository(db *sqlx.DB) IMiddlewaresRepository {
+func MiddlewaresRepository(cfg config.IDbConfig, db databases.IRouter) IMiddlewaresRepository {
 	return &middlewaresRepository{
-		db: db,
+		cfg: cfg,
+		db:  db,
 	}
 }
 
-func (r *middlewaresRepository) FindAccessToken(userId string, accessToken string) bool {
+// FindAccessToken reports whether accessToken is still issued to userId, a
+// signed out or revoked token is not.
+func (r *middlewaresRepository) FindAccessToken(ctx context.Context, userId string, accessToken string) (bool, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	SELECT
 		(CASE WHEN COUNT(*) = 1 THEN TRUE ELSE FALSE END)
@@ -30,14 +38,18 @@ func (r *middlewaresRepository) FindAccessToken(userId string, accessToken strin
 	WHERE "user_id" = $1
 	AND "access_token" = $2;`
 
+	// A token issued a moment ago may not have reached the replicas yet
 	var check bool
-	if err := r.db.Get(&check, query, userId, accessToken); err != nil {
-		return false
+	if err := r.db.Fresh(ctx).GetContext(ctx, &check, query, userId, accessToken); err != nil {
+		return false, apperrors.FromDb(err, "find access token failed")
 	}
-	return true
+	return check, nil
 }
 
-func (r *middlewaresRepository) FindRole() ([]*middlewares.Role, error) {
+func (r *middlewaresRepository) FindRole(ctx context.Context) ([]*middlewares.Role, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	SELECT
 		"id"
@@ -46,8 +58,8 @@ func (r *middlewaresRepository) FindRole() ([]*middlewares.Role, error) {
 	ORDER BY "id" DESC;`
 
 	roles := make([]*middlewares.Role, 0)
-	if err := r.db.Select(&roles, query); err != nil {
-		return nil, fmt.Errorf("roles are empty")
+	if err := r.db.Reader(ctx).SelectContext(ctx, &roles, query); err != nil {
+		return nil, apperrors.Wrap(apperrors.Internal, err, "roles are empty")
 	}
 	return roles, nil
 }
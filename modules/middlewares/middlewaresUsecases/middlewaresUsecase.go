@@ -1,13 +1,15 @@
 package middlewaresUsecases
 
 import (
+	"context"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/middlewares"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/middlewares/middlewaresRepositories"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
 )
 
 type IMiddlewaresUsecases interface {
-	FindAccessToken(userId, accessToken string) bool
-	FindRole() ([]*middlewares.Role, error)
+	FindAccessToken(ctx context.Context, userId, accessToken string) (bool, error)
+	FindRole(ctx context.Context) ([]*middlewares.Role, error)
 }
 
 type middlewaresUsecases struct {
@@ -20,12 +22,18 @@ func MiddlewaresUsecases(middlewaresRepository middlewaresRepositories.IMiddlewa
 	}
 }
 
-func (u *middlewaresUsecases) FindAccessToken(userId, accessToken string) bool {
-	return u.middlewaresRepository.FindAccessToken(userId, accessToken)
+func (u *middlewaresUsecases) FindAccessToken(ctx context.Context, userId, accessToken string) (_ bool, err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "middlewaresUsecases.FindAccessToken")
+	defer func() { kwanjaitrace.End(span, err) }()
+
+	return u.middlewaresRepository.FindAccessToken(ctx, userId, accessToken)
 }
 
-func (u *middlewaresUsecases) FindRole() ([]*middlewares.Role, error) {
-	roles, err := u.middlewaresRepository.FindRole()
+func (u *middlewaresUsecases) FindRole(ctx context.Context) (_ []*middlewares.Role, err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "middlewaresUsecases.FindRole")
+	defer func() { kwanjaitrace.End(span, err) }()
+
+	roles, err := u.middlewaresRepository.FindRole(ctx)
 	if err != nil {
 		return nil, err
 	}
@@ -4,21 +4,27 @@ import (
 	"github/Panyakorn4/kwanjai-shop-tutorial/config"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/entities"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor/monitorUsecases"
 
 	"github.com/gofiber/fiber/v2"
 )
 
 type IMonitorHandler interface {
 	HealthCheck(c *fiber.Ctx) error
+	Liveness(c *fiber.Ctx) error
+	Readiness(c *fiber.Ctx) error
+	Status(c *fiber.Ctx) error
 }
 
 type monitorHandler struct {
-	cfg config.IConfig
+	cfg            config.IConfig
+	monitorUsecase monitorUsecases.IMonitorUsecase
 }
 
-func MonitorHandler(cfg config.IConfig) IMonitorHandler {
+func MonitorHandler(cfg config.IConfig, monitorUsecase monitorUsecases.IMonitorUsecase) IMonitorHandler {
 	return &monitorHandler{
-		cfg: cfg,
+		cfg:            cfg,
+		monitorUsecase: monitorUsecase,
 	}
 }
 
@@ -29,3 +35,28 @@ func (h *monitorHandler) HealthCheck(c *fiber.Ctx) error {
 	}
 	return entities.NewResponse(c).Success(fiber.StatusOK, res).Res()
 }
+
+// Liveness only proves the process serves requests, it checks nothing else
+// so a database outage does not get the process restarted. The probes are
+// answered directly to keep them out of the audit log.
+func (h *monitorHandler) Liveness(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(&monitor.Liveness{
+		Status: monitor.StatusUp,
+	})
+}
+
+// Readiness answers 503 while a dependency is down or the server is
+// shutting down. It is not authenticated, so it only says which dependency
+// is down, Status tells why.
+func (h *monitorHandler) Readiness(c *fiber.Ctx) error {
+	res := h.monitorUsecase.Ready(c.UserContext())
+	status := fiber.StatusOK
+	if !res.Ready {
+		status = fiber.StatusServiceUnavailable
+	}
+	return c.Status(status).JSON(res.Probe())
+}
+
+func (h *monitorHandler) Status(c *fiber.Ctx) error {
+	return entities.NewResponse(c).Success(fiber.StatusOK, h.monitorUsecase.Status(c.UserContext())).Res()
+}
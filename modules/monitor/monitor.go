@@ -1,6 +1,76 @@
 package monitor
 
+import "time"
+
+// Commit is the commit the binary was built from, set with
+// -ldflags "-X github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor.Commit=<sha>".
+// When empty the VCS revision Go stamps into the build is used.
+var Commit string
+
 type Monitor struct {
 	Name    string `json:"name"`
 	Version string `json:"version"`
 }
+
+const (
+	StatusUp   = "up"
+	StatusDown = "down"
+)
+
+// Dependency is the result of checking one dependency of the server.
+type Dependency struct {
+	Name      string  `json:"name"`
+	Status    string  `json:"status"`
+	LatencyMs float64 `json:"latency_ms"`
+	Error     string  `json:"error,omitempty"`
+}
+
+type Liveness struct {
+	Status string `json:"status"`
+}
+
+// Readiness says whether the server should get traffic. While shutting
+// down it is not ready and the dependencies are not checked.
+type Readiness struct {
+	Ready        bool          `json:"ready"`
+	ShuttingDown bool          `json:"shutting_down"`
+	Dependencies []*Dependency `json:"dependencies"`
+}
+
+// Probe is the readiness told to anyone asking: the ready flag and whether
+// each dependency is up. Latencies and errors are left to the status report.
+type Probe struct {
+	Ready        bool               `json:"ready"`
+	ShuttingDown bool               `json:"shutting_down"`
+	Dependencies []*ProbeDependency `json:"dependencies"`
+}
+
+type ProbeDependency struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+}
+
+func (r *Readiness) Probe() *Probe {
+	p := &Probe{
+		Ready:        r.Ready,
+		ShuttingDown: r.ShuttingDown,
+		Dependencies: make([]*ProbeDependency, 0, len(r.Dependencies)),
+	}
+	for _, dep := range r.Dependencies {
+		p.Dependencies = append(p.Dependencies, &ProbeDependency{
+			Name:   dep.Name,
+			Status: dep.Status,
+		})
+	}
+	return p
+}
+
+type StatusReport struct {
+	Name      string    `json:"name"`
+	Version   string    `json:"version"`
+	Commit    string    `json:"commit"`
+	GoVersion string    `json:"go_version"`
+	StartedAt time.Time `json:"started_at"`
+	Uptime    string    `json:"uptime"`
+	*Readiness
+}
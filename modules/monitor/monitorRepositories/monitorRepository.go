@@ -0,0 +1,73 @@
+package monitorRepositories
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
+	"net/http"
+	"net/url"
+)
+
+const storageEndpoint = "https://storage.googleapis.com/"
+
+type IMonitorRepository interface {
+	PingDb(ctx context.Context) error
+	SchemaVersion(ctx context.Context) (applied, latest int, err error)
+	// PingStorage checks the bucket can be reached, not that it can be written.
+	PingStorage(ctx context.Context, bucket string) error
+}
+
+type monitorRepository struct {
+	db          databases.ICluster
+	migrator    databases.IMigrator
+	migratorErr error
+	client      *http.Client
+}
+
+func MonitorRepository(db databases.ICluster) IMonitorRepository {
+	migrator, err := databases.Migrator(db.Primary())
+	return &monitorRepository{
+		db:          db,
+		migrator:    migrator,
+		migratorErr: err,
+		// The checks bound every call with their own deadline
+		client: &http.Client{Transport: kwanjaitrace.Transport(nil)},
+	}
+}
+
+func (r *monitorRepository) PingDb(ctx context.Context) error {
+	if err := r.db.Primary().PingContext(ctx); err != nil {
+		return fmt.Errorf("ping db failed: %v", err)
+	}
+	return nil
+}
+
+func (r *monitorRepository) SchemaVersion(ctx context.Context) (int, int, error) {
+	if r.migratorErr != nil {
+		return 0, 0, r.migratorErr
+	}
+	return r.migrator.Version(ctx)
+}
+
+// PingStorage asks for the bucket anonymously: a private bucket answers 401
+// or 403, which still proves it exists and the storage API is reachable.
+func (r *monitorRepository) PingStorage(ctx context.Context, bucket string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, storageEndpoint+url.PathEscape(bucket), nil)
+	if err != nil {
+		return fmt.Errorf("build storage request failed: %v", err)
+	}
+	res, err := r.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("reach storage failed: %v", err)
+	}
+	res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("bucket %s not found", bucket)
+	case res.StatusCode >= http.StatusInternalServerError:
+		return fmt.Errorf("storage answered %d", res.StatusCode)
+	}
+	return nil
+}
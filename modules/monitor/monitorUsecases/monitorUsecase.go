@@ -0,0 +1,232 @@
+package monitorUsecases
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor/monitorRepositories"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
+	"runtime"
+	"runtime/debug"
+	"sync"
+	"time"
+)
+
+type IMonitorUsecase interface {
+	Ready(ctx context.Context) *monitor.Readiness
+	Status(ctx context.Context) *monitor.StatusReport
+}
+
+// storageCacheTtl is how long a storage check answers for, so the probes do
+// not send a request to the storage API every few seconds.
+const storageCacheTtl = 30 * time.Second
+
+type monitorUsecase struct {
+	cfg               config.IConfig
+	monitorRepository monitorRepositories.IMonitorRepository
+	shuttingDown      func() bool
+	startedAt         time.Time
+	storage           *cachedCheck
+}
+
+// MonitorUsecase reports the server as not ready as soon as shuttingDown
+// returns true, so the load balancer stops sending requests before the
+// server stops taking them.
+func MonitorUsecase(cfg config.IConfig, monitorRepository monitorRepositories.IMonitorRepository, shuttingDown func() bool) IMonitorUsecase {
+	return &monitorUsecase{
+		cfg:               cfg,
+		monitorRepository: monitorRepository,
+		shuttingDown:      shuttingDown,
+		startedAt:         time.Now(),
+		storage:           &cachedCheck{ttl: storageCacheTtl},
+	}
+}
+
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+func (u *monitorUsecase) checks() []*check {
+	checks := []*check{
+		{name: "database", run: u.monitorRepository.PingDb},
+		{name: "migrations", run: u.checkMigrations},
+	}
+	if bucket := u.cfg.App().GCPBucket(); bucket != "" {
+		checks = append(checks, &check{
+			name: "storage",
+			run: func(ctx context.Context) error {
+				return u.storage.run(ctx, bucket, func(ctx context.Context) error {
+					return u.monitorRepository.PingStorage(ctx, bucket)
+				})
+			},
+		})
+	}
+	return checks
+}
+
+// cachedCheck keeps the result of a check for ttl. Once it expired one
+// probe checks again while the others answer with the last result, so a
+// slow backend holds up a single probe. key is what the check is about, a
+// new key has no result yet and its probes wait for the one check.
+type cachedCheck struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	key     string
+	at      time.Time
+	err     error
+	pending *pendingCheck
+}
+
+// pendingCheck is the check in flight, err is set once done is closed.
+type pendingCheck struct {
+	key  string
+	done chan struct{}
+	err  error
+}
+
+func (c *cachedCheck) run(ctx context.Context, key string, check func(ctx context.Context) error) error {
+	c.mu.Lock()
+	p := c.pending
+	switch {
+	case key == c.key && (time.Since(c.at) < c.ttl || p != nil):
+		err := c.err
+		c.mu.Unlock()
+		return err
+	case p != nil && p.key == key:
+		c.mu.Unlock()
+		select {
+		case <-p.done:
+			return p.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	p = &pendingCheck{key: key, done: make(chan struct{})}
+	c.pending = p
+	c.mu.Unlock()
+
+	p.err = check(ctx)
+
+	c.mu.Lock()
+	c.key, c.err, c.at = key, p.err, time.Now()
+	if c.pending == p {
+		c.pending = nil
+	}
+	c.mu.Unlock()
+	close(p.done)
+	return p.err
+}
+
+// checkMigrations fails while migrations are pending. A schema ahead of the
+// binary is fine, it is what an instance sees during a rolling deploy.
+func (u *monitorUsecase) checkMigrations(ctx context.Context) error {
+	applied, latest, err := u.monitorRepository.SchemaVersion(ctx)
+	if err != nil {
+		return err
+	}
+	if applied < latest {
+		return fmt.Errorf("schema is at version %d, expected %d", applied, latest)
+	}
+	return nil
+}
+
+// dependencies runs every check at once, each bounded by the health check
+// timeout, and returns them in a fixed order.
+func (u *monitorUsecase) dependencies(ctx context.Context) []*monitor.Dependency {
+	checks := u.checks()
+	deps := make([]*monitor.Dependency, len(checks))
+	timeout := u.cfg.App().HealthCheckTimeout()
+
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := c.run(ctx)
+			dep := &monitor.Dependency{
+				Name:      c.name,
+				Status:    monitor.StatusUp,
+				LatencyMs: float64(time.Since(start).Microseconds()) / 1000,
+			}
+			if err != nil {
+				dep.Status = monitor.StatusDown
+				dep.Error = err.Error()
+			}
+			deps[i] = dep
+		}(i, c)
+	}
+	wg.Wait()
+	return deps
+}
+
+func (u *monitorUsecase) Ready(ctx context.Context) *monitor.Readiness {
+	ctx, span := kwanjaitrace.Start(ctx, "monitorUsecase.Ready")
+	defer span.End()
+
+	if u.shuttingDown() {
+		return &monitor.Readiness{
+			ShuttingDown: true,
+			Dependencies: make([]*monitor.Dependency, 0),
+		}
+	}
+	res := &monitor.Readiness{
+		Ready:        true,
+		Dependencies: u.dependencies(ctx),
+	}
+	for _, dep := range res.Dependencies {
+		if dep.Status != monitor.StatusUp {
+			res.Ready = false
+		}
+	}
+	return res
+}
+
+func (u *monitorUsecase) Status(ctx context.Context) *monitor.StatusReport {
+	ctx, span := kwanjaitrace.Start(ctx, "monitorUsecase.Status")
+	defer span.End()
+
+	return &monitor.StatusReport{
+		Name:      u.cfg.App().Name(),
+		Version:   u.cfg.App().Version(),
+		Commit:    commit(),
+		GoVersion: runtime.Version(),
+		StartedAt: u.startedAt,
+		Uptime:    time.Since(u.startedAt).Round(time.Second).String(),
+		Readiness: u.Ready(ctx),
+	}
+}
+
+// commit is monitor.Commit, or the revision stamped by the Go toolchain with
+// a -dirty suffix for a build from a modified tree.
+func commit() string {
+	if monitor.Commit != "" {
+		return monitor.Commit
+	}
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "unknown"
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if revision == "" {
+		return "unknown"
+	}
+	if modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
@@ -0,0 +1,33 @@
+package servers
+
+import (
+	"errors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/entities"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+type serverErrCode string
+
+const (
+	serverErr serverErrCode = "server-001"
+)
+
+// errorHandler renders every error that reaches Fiber, returned by a handler
+// or raised by the framework itself (body limit, read timeout), in the
+// same shape as the handlers' own error responses. An error fasthttp raised
+// while reading the request never went through ErrorFormat, so the format
+// is picked here as well.
+func (s *server) errorHandler(c *fiber.Ctx, err error) error {
+	entities.SetErrorFormat(c, s.cfg.App().ErrorFormat())
+	var fe *fiber.Error
+	if errors.As(err, &fe) {
+		return entities.NewResponse(c).Error(
+			fe.Code,
+			string(serverErr),
+			strings.ToLower(fe.Message),
+		).Res()
+	}
+	return entities.NewResponse(c).Fail(string(serverErr), err).Res()
+}
@@ -5,15 +5,21 @@ import (
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/middlewares/middlewaresRepositories"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/middlewares/middlewaresUsecases"
 	monitorHandlers "github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor/handlersHandlers"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor/monitorRepositories"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/monitor/monitorUsecases"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersHandlers"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersRepositories"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersUsecases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaimetrics"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
 
 	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/adaptor"
 )
 
 type IModuleFactory interface {
 	MonitorModule()
+	MetricsModule()
 	UsersModule()
 }
 
@@ -32,29 +38,47 @@ func InitModule(r fiber.Router, s *server, mid middlewaresHandlers.IMiddlewaresH
 }
 
 func InitMiddlewares(s *server) middlewaresHandlers.IMiddlewaresHandlers {
-	repository := middlewaresRepositories.MiddlewaresRepository(s.db)
+	repository := middlewaresRepositories.MiddlewaresRepository(s.cfg.Db(), s.db)
 	usecase := middlewaresUsecases.MiddlewaresUsecases(repository)
-	return middlewaresHandlers.MiddlewaresHandlers(s.cfg, usecase)
+	return middlewaresHandlers.MiddlewaresHandlers(s.cfg, s.logger, usecase)
 }
 
+// MonitorModule serves the probes at the root, where orchestrators expect
+// them, and the detailed status to admins only.
 func (m *moduleFactory) MonitorModule() {
-	handler := monitorHandlers.MonitorHandler(m.s.cfg)
-	m.r.Get("/", handler.HealthCheck)
+	repository := monitorRepositories.MonitorRepository(m.s.db)
+	usecase := monitorUsecases.MonitorUsecase(m.s.cfg, repository, m.s.shuttingDown.Load)
+	handler := monitorHandlers.MonitorHandler(m.s.cfg, usecase)
 
+	m.r.Get("/", kwanjaitrace.Handler("monitorHandler.HealthCheck", handler.HealthCheck))
+	m.s.app.Get("/healthz", kwanjaitrace.Handler("monitorHandler.Liveness", handler.Liveness))
+	m.s.app.Get("/readyz", kwanjaitrace.Handler("monitorHandler.Readiness", handler.Readiness))
+	m.r.Get("/monitor/status", m.mid.JwtAuth(), m.mid.Authorize(2), kwanjaitrace.Handler("monitorHandler.Status", handler.Status))
+}
+
+// MetricsModule serves the metrics at the root, outside the versioned API.
+func (m *moduleFactory) MetricsModule() {
+	if !m.s.cfg.Metrics().Enabled() {
+		return
+	}
+	if err := kwanjaimetrics.RegisterDbStats(m.s.db.Stats); err != nil {
+		m.s.logger.Error("register db stats failed", "error", err)
+	}
+	m.s.app.Get(m.s.cfg.Metrics().Path(), m.mid.MetricsGuard(), adaptor.HTTPHandler(kwanjaimetrics.Handler()))
 }
 
 func (m *moduleFactory) UsersModule() {
-	repository := usersRepositories.UsersRepository(m.s.db)
-	usecase := usersUsecases.UsersUsecase(m.s.cfg, repository)
+	repository := usersRepositories.UsersRepository(m.s.cfg.Db(), m.s.logger, m.s.db)
+	usecase := usersUsecases.UsersUsecase(m.s.cfg, m.s.logger, repository)
 	handler := usersHandlers.UsersHandler(m.s.cfg, usecase)
 
 	router := m.r.Group("/users")
-	router.Post("/signup", handler.SignUpCustomer)
-	router.Post("/signin", handler.SignIn)
-	router.Post("/refresh", handler.RefreshPassport)
-	router.Post("/signout", handler.SignOut)
-	router.Post("/signup-admin", handler.SignOut)
-
-	router.Get("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), handler.GetUserProfile)
-	router.Get("/admin/secret", m.mid.JwtAuth(), m.mid.Authorize(2), handler.GenerateAdminToken)
+	router.Post("/signup", kwanjaitrace.Handler("usersHandler.SignUpCustomer", handler.SignUpCustomer))
+	router.Post("/signin", kwanjaitrace.Handler("usersHandler.SignIn", handler.SignIn))
+	router.Post("/refresh", kwanjaitrace.Handler("usersHandler.RefreshPassport", handler.RefreshPassport))
+	router.Post("/signout", kwanjaitrace.Handler("usersHandler.SignOut", handler.SignOut))
+	router.Post("/signup-admin", m.mid.JwtAuth(), m.mid.Authorize(2), kwanjaitrace.Handler("usersHandler.SignUpAdmin", handler.SignUpAdmin))
+
+	router.Get("/:user_id", m.mid.JwtAuth(), m.mid.ParamsCheck(), kwanjaitrace.Handler("usersHandler.GetUserProfile", handler.GetUserProfile))
+	router.Get("/admin/secret", m.mid.JwtAuth(), m.mid.Authorize(2), kwanjaitrace.Handler("usersHandler.GenerateAdminToken", handler.GenerateAdminToken))
 }
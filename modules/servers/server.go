@@ -1,63 +1,150 @@
 package servers
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"github/Panyakorn4/kwanjai-shop-tutorial/config"
-	"log"
-	"os"
-	"os/signal"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"log/slog"
+	"sync/atomic"
+	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/jmoiron/sqlx"
 )
 
 type IServer interface {
-	Start()
+	// Start serves until ctx is done, then shuts down gracefully. It returns
+	// an error when the server cannot listen or the drain timed out.
+	Start(ctx context.Context) error
 }
 
 type server struct {
-	app *fiber.App
-	cfg config.IConfig
-	db  *sqlx.DB
+	app    *fiber.App
+	cfg    config.IConfig
+	logger *slog.Logger
+	db     databases.ICluster
+	// shuttingDown turns /readyz unhealthy once a shutdown has begun
+	shuttingDown atomic.Bool
 }
 
-func NewServer(cfg config.IConfig, db *sqlx.DB) IServer {
-	return &server{
-		cfg: cfg,
-		db:  db,
-		app: fiber.New(fiber.Config{
-			AppName:      cfg.App().Name(),
-			BodyLimit:    cfg.App().BodyLimit(),
-			ReadTimeout:  cfg.App().ReadTimeout(),
-			WriteTimeout: cfg.App().WriteTimeout(),
-			JSONEncoder:  json.Marshal,
-			JSONDecoder:  json.Unmarshal,
-		}),
+// NewServer serves with logger, which the modules get handed for their own
+// package loggers.
+func NewServer(cfg config.IConfig, logger *slog.Logger, db databases.ICluster) IServer {
+	s := &server{
+		cfg:    cfg,
+		logger: logger,
+		db:     db,
 	}
+	s.app = fiber.New(fiber.Config{
+		AppName:      cfg.App().Name(),
+		BodyLimit:    cfg.App().BodyLimit(),
+		ReadTimeout:  cfg.App().ReadTimeout(),
+		WriteTimeout: cfg.App().WriteTimeout(),
+		JSONEncoder:  json.Marshal,
+		JSONDecoder:  json.Unmarshal,
+		ErrorHandler: s.errorHandler,
+	})
+	return s
 }
 
-func (s *server) Start() {
+func (s *server) Start(ctx context.Context) error {
+	logger := kwanjailogger.For(s.logger, "servers")
+
+	// Cancelled once the drain timed out, to stop the requests still running
+	abortCtx, abort := context.WithCancel(context.Background())
+	defer abort()
+
 	// Middlewares
 	middlewares := InitMiddlewares(s)
+	s.app.Use(middlewares.Trace())
+	s.app.Use(middlewares.RequestId())
+	s.app.Use(middlewares.ErrorFormat())
+	s.app.Use(middlewares.Metrics())
 	s.app.Use(middlewares.Logger())
+	s.app.Use(middlewares.Recover())
 	s.app.Use(middlewares.Core())
+	s.app.Use(middlewares.RequestContext(abortCtx))
+	s.app.Use(middlewares.RateLimit())
 	// Modules
 	v1 := s.app.Group("v1")
 	modules := InitModule(v1, s, middlewares)
 
 	modules.MonitorModule()
+	modules.MetricsModule()
 	modules.UsersModule()
 	s.app.Use(middlewares.RouterCheck())
-	// Graceful shutdown
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+
+	// Config hot reload
+	watchCtx, stopWatch := context.WithCancel(context.Background())
+	watchDone := make(chan struct{})
 	go func() {
-		_ = <-c
-		log.Println("server is shutting down ...")
-		_ = s.app.Shutdown()
+		defer close(watchDone)
+		if err := config.Watch(watchCtx, s.cfg, func(cfg config.IConfig) {
+			if err := kwanjailogger.Reload(cfg.Log()); err != nil {
+				logger.Error("reload logger failed", "error", err)
+			}
+		}); err != nil {
+			logger.Error("watch config failed", "error", err)
+		}
+	}()
+	defer func() {
+		stopWatch()
+		<-watchDone
 	}()
 
 	// Listen to host:port
-	log.Printf("server is starting on %v", s.cfg.App().Url())
-	s.app.Listen(s.cfg.App().Url())
+	logger.Info("server is starting", "url", s.cfg.App().Url())
+	listening := make(chan struct{})
+	s.app.Hooks().OnListen(func(fiber.ListenData) error {
+		close(listening)
+		return nil
+	})
+	listenErr := make(chan error, 1)
+	go func() {
+		listenErr <- s.app.Listen(s.cfg.App().Url())
+	}()
+
+	// A shutdown before the listener is up would find nothing to stop, so a
+	// signal received while starting is only handled once it is listening
+	select {
+	case err := <-listenErr:
+		return fmt.Errorf("listen on %s failed: %v", s.cfg.App().Url(), err)
+	case <-listening:
+	}
+	select {
+	case err := <-listenErr:
+		return fmt.Errorf("serve failed: %v", err)
+	case <-ctx.Done():
+	}
+	return s.shutdown(logger, abort, listenErr)
+}
+
+// shutdown fails the readiness probe first and keeps serving for the
+// shutdown delay, so the load balancer stops routing here before the
+// listener closes. In-flight requests then get the shutdown timeout to
+// finish, those still running after it are cancelled.
+func (s *server) shutdown(logger *slog.Logger, abort context.CancelFunc, listenErr <-chan error) error {
+	s.shuttingDown.Store(true)
+	if delay := s.cfg.App().ShutdownDelay(); delay > 0 {
+		logger.Info("server is shutting down, waiting for traffic to stop", "delay", delay)
+		time.Sleep(delay)
+	}
+
+	timeout := s.cfg.App().ShutdownTimeout()
+	logger.Info("server is draining requests", "timeout", timeout)
+	err := s.app.ShutdownWithTimeout(timeout)
+	if err != nil {
+		abort()
+		err = fmt.Errorf("drain requests failed after %s: %v", timeout, err)
+	}
+	if lerr := <-listenErr; lerr != nil && err == nil {
+		err = fmt.Errorf("serve failed: %v", lerr)
+	}
+	if err != nil {
+		return err
+	}
+	logger.Info("server is stopped")
+	return nil
 }
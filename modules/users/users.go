@@ -1,10 +1,7 @@
 package users
 
 import (
-	"fmt"
-	"regexp"
-
-	"golang.org/x/crypto/bcrypt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaipassword"
 )
 
 type User struct {
@@ -15,14 +12,14 @@ type User struct {
 }
 
 type UserRegisterReq struct {
-	Email    string `db:"email" json:"email" form:"email"`
-	Password string `db:"password" json:"password" form:"password"`
-	Username string `db:"username" json:"username" form:"username"`
+	Email    string `db:"email" json:"email" form:"email" validate:"required,email,max=255"`
+	Password string `db:"password" json:"password" form:"password" validate:"required,max=72"`
+	Username string `db:"username" json:"username" form:"username" validate:"required,min=3,max=32,username"`
 }
 
 type UserCredential struct {
-	Email    string `db:"email" json:"email" form:"email"`
-	Password string `db:"password" json:"password" form:"password"`
+	Email    string `db:"email" json:"email" form:"email" validate:"required,email"`
+	Password string `db:"password" json:"password" form:"password" validate:"required"`
 }
 
 type UserCredentialCheck struct {
@@ -33,23 +30,16 @@ type UserCredentialCheck struct {
 	RoleId   int    `db:"role_id"`
 }
 
-func (obj *UserRegisterReq) BcryptHashing() error {
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(obj.Password), 10)
+// HashPassword replaces the plain text password with its hash.
+func (obj *UserRegisterReq) HashPassword(hasher kwanjaipassword.IHasher) error {
+	hashedPassword, err := hasher.Hash(obj.Password)
 	if err != nil {
-		return fmt.Errorf("hashed password failed: %v", err)
+		return err
 	}
-	obj.Password = string(hashedPassword)
+	obj.Password = hashedPassword
 	return nil
 }
 
-func (obj *UserRegisterReq) IsEmail() bool {
-	match, err := regexp.MatchString(`^[\w-\.]+@([\w-]+\.)+[\w-]{2,4}$`, obj.Email)
-	if err != nil {
-		return false
-	}
-	return match
-}
-
 type UserPassport struct {
 	User  *User      `json:"user"`
 	Token *UserToken `json:"token"`
@@ -66,7 +56,7 @@ type UserClaims struct {
 	RoleId int    `db:"role" json:"role"`
 }
 type UserRefreshCredential struct {
-	RefreshToken string `json:"refresh_token" form:"refresh_token"`
+	RefreshToken string `json:"refresh_token" form:"refresh_token" validate:"required"`
 }
 
 type Oauth struct {
@@ -74,5 +64,5 @@ type Oauth struct {
 	UserId string `db:"user_id" json:"user_id"`
 }
 type UserRemoveCredential struct {
-	OauthId string `json:"oauth_id" form:"oauth_id"`
+	OauthId string `json:"oauth_id" form:"oauth_id" validate:"required,uuid"`
 }
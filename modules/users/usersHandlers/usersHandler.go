@@ -6,6 +6,7 @@ import (
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersUsecases"
 	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaiauth"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaivalidator"
 	"strings"
 
 	"github.com/gofiber/fiber/v2"
@@ -45,157 +46,71 @@ func UsersHandler(cfg config.IConfig, usersUsecase usersUsecases.IUsersUsecase)
 	}
 }
 func (h *usersHandler) SignUpCustomer(c *fiber.Ctx) error {
-	// Request body parser
-	req := new(users.UserRegisterReq)
-	if err := c.BodyParser(req); err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signUpCustomerErr),
-			err.Error(),
-		).Res()
-	}
-
-	// Email validation
-	if !req.IsEmail() {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signUpCustomerErr),
-			"email pattern is invalid",
-		).Res()
+	// Request body parser and validation
+	req, err := kwanjaivalidator.BindBody[users.UserRegisterReq](c)
+	if err != nil {
+		return entities.NewResponse(c).Fail(string(signUpCustomerErr), err).Res()
 	}
 
 	// Insert
-	result, err := h.usersUsecase.InsertCustomer(req)
+	result, err := h.usersUsecase.InsertCustomer(c.UserContext(), req)
 	if err != nil {
-		switch err.Error() {
-		case "username has been used":
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(signUpCustomerErr),
-				err.Error(),
-			).Res()
-		case "email has been used":
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(signUpCustomerErr),
-				err.Error(),
-			).Res()
-		default:
-			return entities.NewResponse(c).Error(
-				fiber.ErrInternalServerError.Code,
-				string(signUpCustomerErr),
-				err.Error(),
-			).Res()
-		}
+		return entities.NewResponse(c).Fail(string(signUpCustomerErr), err).Res()
 	}
 	return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
 }
 
 func (h *usersHandler) SignIn(c *fiber.Ctx) error {
-	req := new(users.UserCredential)
-	if err := c.BodyParser(req); err != nil {
-		return entities.NewResponse(c).Error(fiber.ErrBadRequest.Code,
-			string(signInErr),
-			err.Error(),
-		).Res()
+	req, err := kwanjaivalidator.BindBody[users.UserCredential](c)
+	if err != nil {
+		return entities.NewResponse(c).Fail(string(signInErr), err).Res()
 	}
 
-	passport, err := h.usersUsecase.GetPassport(req)
+	passport, err := h.usersUsecase.GetPassport(c.UserContext(), req)
 	if err != nil {
-		return entities.NewResponse(c).Error(fiber.ErrBadRequest.Code,
-			string(signInErr),
-			err.Error(),
-		).Res()
+		return entities.NewResponse(c).Fail(string(signInErr), err).Res()
 	}
 	return entities.NewResponse(c).Success(fiber.StatusOK, passport).Res()
 }
 
 func (h *usersHandler) RefreshPassport(c *fiber.Ctx) error {
-	req := new(users.UserRefreshCredential)
-	if err := c.BodyParser(req); err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(refreshPassportErr),
-			err.Error(),
-		).Res()
+	req, err := kwanjaivalidator.BindBody[users.UserRefreshCredential](c)
+	if err != nil {
+		return entities.NewResponse(c).Fail(string(refreshPassportErr), err).Res()
 	}
 
-	passport, err := h.usersUsecase.RefreshPassport(req)
+	passport, err := h.usersUsecase.RefreshPassport(c.UserContext(), req)
 
 	if err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(refreshPassportErr),
-			err.Error(),
-		).Res()
+		return entities.NewResponse(c).Fail(string(refreshPassportErr), err).Res()
 	}
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, passport).Res()
 }
 
 func (h *usersHandler) SignOut(c *fiber.Ctx) error {
-	req := new(users.UserRemoveCredential)
-	if err := c.BodyParser(req); err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signOutErr),
-			err.Error(),
-		).Res()
+	req, err := kwanjaivalidator.BindBody[users.UserRemoveCredential](c)
+	if err != nil {
+		return entities.NewResponse(c).Fail(string(signOutErr), err).Res()
 	}
 
-	if err := h.usersUsecase.DeleteOauth(req.OauthId); err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signOutErr),
-			err.Error(),
-		).Res()
+	if err := h.usersUsecase.DeleteOauth(c.UserContext(), req.OauthId); err != nil {
+		return entities.NewResponse(c).Fail(string(signOutErr), err).Res()
 	}
 
 	return entities.NewResponse(c).Success(fiber.StatusOK, nil).Res()
 }
 
 func (h *usersHandler) SignUpAdmin(c *fiber.Ctx) error {
-	// Request body parser
-	req := new(users.UserRegisterReq)
-	if err := c.BodyParser(req); err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signUpCustomerErr),
-			err.Error(),
-		).Res()
-	}
-
-	// Email validation
-	if !req.IsEmail() {
-		return entities.NewResponse(c).Error(
-			fiber.ErrBadRequest.Code,
-			string(signUpCustomerErr),
-			"email pattern is invalid",
-		).Res()
+	// Request body parser and validation
+	req, err := kwanjaivalidator.BindBody[users.UserRegisterReq](c)
+	if err != nil {
+		return entities.NewResponse(c).Fail(string(singUpAdminErr), err).Res()
 	}
 	// Insert
-	result, err := h.usersUsecase.InsertCustomer(req)
+	result, err := h.usersUsecase.InsertAdmin(c.UserContext(), req)
 	if err != nil {
-		switch err.Error() {
-		case "username has been used":
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(signUpCustomerErr),
-				err.Error(),
-			).Res()
-		case "email has been used":
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(signUpCustomerErr),
-				err.Error(),
-			).Res()
-		default:
-			return entities.NewResponse(c).Error(
-				fiber.ErrInternalServerError.Code,
-				string(signUpCustomerErr),
-				err.Error(),
-			).Res()
-		}
+		return entities.NewResponse(c).Fail(string(singUpAdminErr), err).Res()
 	}
 	return entities.NewResponse(c).Success(fiber.StatusCreated, result).Res()
 }
@@ -207,11 +122,7 @@ func (h *usersHandler) GenerateAdminToken(c *fiber.Ctx) error {
 		nil,
 	)
 	if err != nil {
-		return entities.NewResponse(c).Error(
-			fiber.ErrInternalServerError.Code,
-			string(generateTokenAdminErr),
-			err.Error(),
-		).Res()
+		return entities.NewResponse(c).Fail(string(generateTokenAdminErr), err).Res()
 	}
 
 	return entities.NewResponse(c).Success(
@@ -228,22 +139,9 @@ func (h *usersHandler) GetUserProfile(c *fiber.Ctx) error {
 	userId := strings.Trim(c.Params("user_id"), " ")
 
 	// Get profile
-	result, err := h.usersUsecase.GetUserProfile(userId)
+	result, err := h.usersUsecase.GetUserProfile(c.UserContext(), userId)
 	if err != nil {
-		switch err.Error() {
-		case "get user failed: sql: no rows in result set":
-			return entities.NewResponse(c).Error(
-				fiber.ErrBadRequest.Code,
-				string(getUserProfile),
-				err.Error(),
-			).Res()
-		default:
-			return entities.NewResponse(c).Error(
-				fiber.ErrInternalServerError.Code,
-				string(getUserProfile),
-				err.Error(),
-			).Res()
-		}
+		return entities.NewResponse(c).Fail(string(getUserProfile), err).Res()
 	}
 	return entities.NewResponse(c).Success(fiber.StatusOK, result).Res()
 }
@@ -3,23 +3,21 @@ package usersPatterns
 import (
 	"context"
 	"encoding/json"
-	"fmt"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
-	"time"
-
-	"github.com/jmoiron/sqlx"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
 )
 
 type IInsertUser interface {
-	Customer() (IInsertUser, error)
-	Admin() (IInsertUser, error)
-	Result() (*users.UserPassport, error)
+	Customer(ctx context.Context) (IInsertUser, error)
+	Admin(ctx context.Context) (IInsertUser, error)
+	Result(ctx context.Context) (*users.UserPassport, error)
 }
 
 type userReq struct {
 	id  string
 	req *users.UserRegisterReq
-	db  *sqlx.DB
+	db  databases.IQueryer
 }
 
 type customer struct {
@@ -29,14 +27,14 @@ type admin struct {
 	*userReq
 }
 
-func InsertUser(db *sqlx.DB, req *users.UserRegisterReq, isAdmin bool) IInsertUser {
+func InsertUser(db databases.IQueryer, req *users.UserRegisterReq, isAdmin bool) IInsertUser {
 	if isAdmin {
 		return newAdmin(db, req)
 	}
 	return newCustomer(db, req)
 }
 
-func newCustomer(db *sqlx.DB, req *users.UserRegisterReq) IInsertUser {
+func newCustomer(db databases.IQueryer, req *users.UserRegisterReq) IInsertUser {
 	return &customer{
 		userReq: &userReq{
 			req: req,
@@ -45,7 +43,7 @@ func newCustomer(db *sqlx.DB, req *users.UserRegisterReq) IInsertUser {
 	}
 }
 
-func newAdmin(db *sqlx.DB, req *users.UserRegisterReq) IInsertUser {
+func newAdmin(db databases.IQueryer, req *users.UserRegisterReq) IInsertUser {
 	return &admin{
 		userReq: &userReq{
 			req: req,
@@ -53,10 +51,7 @@ func newAdmin(db *sqlx.DB, req *users.UserRegisterReq) IInsertUser {
 		},
 	}
 }
-func (f *userReq) Customer() (IInsertUser, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
+func (f *userReq) Customer(ctx context.Context) (IInsertUser, error) {
 	query := `
 	INSERT INTO  "users" (
 		"email",
@@ -76,22 +71,12 @@ func (f *userReq) Customer() (IInsertUser, error) {
 		f.req.Password,
 		f.req.Username,
 	).Scan(&f.id); err != nil {
-		switch err.Error() {
-		case "ERROR: duplicate key value violates unique constraint \"users_username_key\" (SQLSTATE 23505)":
-			return nil, fmt.Errorf("username has been used")
-		case "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)":
-			return nil, fmt.Errorf("email has been used")
-		default:
-			return nil, fmt.Errorf("insert user failed: %v", err)
-		}
+		return nil, insertUserErr(err)
 	}
 	return f, nil
 }
 
-func (f *userReq) Admin() (IInsertUser, error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-	defer cancel()
-
+func (f *userReq) Admin(ctx context.Context) (IInsertUser, error) {
 	query := `
 	INSERT INTO  "users" (
 		"email",
@@ -111,19 +96,23 @@ func (f *userReq) Admin() (IInsertUser, error) {
 		f.req.Password,
 		f.req.Username,
 	).Scan(&f.id); err != nil {
-		switch err.Error() {
-		case "ERROR: duplicate key value violates unique constraint \"users_username_key\" (SQLSTATE 23505)":
-			return nil, fmt.Errorf("username has been used")
-		case "ERROR: duplicate key value violates unique constraint \"users_email_key\" (SQLSTATE 23505)":
-			return nil, fmt.Errorf("email has been used")
-		default:
-			return nil, fmt.Errorf("insert user failed: %v", err)
-		}
+		return nil, insertUserErr(err)
 	}
 	return f, nil
 }
 
-func (f *userReq) Result() (*users.UserPassport, error) {
+func insertUserErr(err error) error {
+	switch {
+	case apperrors.IsConstraint(err, apperrors.PgUniqueViolation, "users_username_key"):
+		return apperrors.Wrap(apperrors.Conflict, err, "username has been used")
+	case apperrors.IsConstraint(err, apperrors.PgUniqueViolation, "users_email_key"):
+		return apperrors.Wrap(apperrors.Conflict, err, "email has been used")
+	default:
+		return apperrors.FromDb(err, "insert user failed")
+	}
+}
+
+func (f *userReq) Result(ctx context.Context) (*users.UserPassport, error) {
 	query := `
 	SELECT
 		json_build_object(
@@ -141,13 +130,13 @@ func (f *userReq) Result() (*users.UserPassport, error) {
 	) AS "t"`
 
 	data := make([]byte, 0)
-	if err := f.db.Get(&data, query, f.id); err != nil {
-		return nil, fmt.Errorf("get user failed: %v", err)
+	if err := f.db.GetContext(ctx, &data, query, f.id); err != nil {
+		return nil, apperrors.FromDb(err, "get user failed")
 	}
 
 	user := new(users.UserPassport)
 	if err := json.Unmarshal(data, &user); err != nil {
-		return nil, fmt.Errorf("unmarshal user failed: %v", err)
+		return nil, apperrors.NewInternal(err, "unmarshal user failed")
 	}
 	return user, nil
 }
@@ -2,58 +2,102 @@ package usersRepositories
 
 import (
 	"context"
-	"fmt"
+	"database/sql"
+	"errors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersPatterns"
-	"time"
-
-	"github.com/jmoiron/sqlx"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"log/slog"
 )
 
 type IUsersRepository interface {
-	InsertUser(req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error)
-	FindOneUserByEmail(email string) (*users.UserCredentialCheck, error)
-	InsertOauth(req *users.UserPassport) error
-	FindOneOauth(refreshToken string) (*users.Oauth, error)
-	UpdateOauth(req *users.UserToken) error
-	GetProfile(userId string) (*users.User, error)
-	DeleteOauth(oauthId string) error
+	WithTx(ctx context.Context, fn func(repo IUsersRepository) error) error
+	InsertUser(ctx context.Context, req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error)
+	FindOneUserByEmail(ctx context.Context, email string) (*users.UserCredentialCheck, error)
+	InsertOauth(ctx context.Context, req *users.UserPassport) error
+	FindOneOauth(ctx context.Context, refreshToken string) (*users.Oauth, error)
+	UpdateOauth(ctx context.Context, req *users.UserToken) error
+	GetProfile(ctx context.Context, userId string) (*users.User, error)
+	DeleteOauth(ctx context.Context, oauthId string) error
+	UpdatePassword(ctx context.Context, email, password string) (string, error)
+	DeleteOauthByUserId(ctx context.Context, userId string) error
 }
 
 type usersRepository struct {
-	db *sqlx.DB
+	cfg    config.IDbConfig
+	logger *slog.Logger
+	db     databases.IRouter
 }
 
-func UsersRepository(db *sqlx.DB) IUsersRepository {
+// UsersRepository reads and writes through db. Sign in and token lookups
+// must see the latest write, so only the profile read goes to a replica.
+func UsersRepository(cfg config.IDbConfig, logger *slog.Logger, db databases.IRouter) IUsersRepository {
 	return &usersRepository{
-		db: db,
+		cfg:    cfg,
+		logger: kwanjailogger.For(logger, "users"),
+		db:     db,
 	}
 }
-func (r *usersRepository) InsertUser(req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error) {
-	result := usersPatterns.InsertUser(r.db, req, isAdmin)
+
+// WithTx hands fn a repository bound to a transaction, nested calls join the outer one.
+func (r *usersRepository) WithTx(ctx context.Context, fn func(repo IUsersRepository) error) error {
+	return databases.RunInTx(ctx, r.db.Writer(ctx), func(tx databases.IQueryer) error {
+		return fn(&usersRepository{
+			cfg:    r.cfg,
+			logger: r.logger,
+			db:     databases.Single(tx),
+		})
+	})
+}
+
+func (r *usersRepository) InsertUser(ctx context.Context, req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
+	var user *users.UserPassport
+	// The insert and the read back of the new user must see the same data
+	err := databases.RunInTx(ctx, r.db.Writer(ctx), func(tx databases.IQueryer) error {
+		var err error
+		user, err = insertUser(ctx, tx, req, isAdmin)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func insertUser(ctx context.Context, db databases.IQueryer, req *users.UserRegisterReq, isAdmin bool) (*users.UserPassport, error) {
+	result := usersPatterns.InsertUser(db, req, isAdmin)
 
 	var err error
 	if isAdmin {
-		result, err = result.Admin()
+		result, err = result.Admin(ctx)
 		if err != nil {
 			return nil, err
 		}
 	} else {
-		result, err = result.Customer()
+		result, err = result.Customer(ctx)
 		if err != nil {
 			return nil, err
 		}
 	}
 
 	// Get result from inserting
-	user, err := result.Result()
+	user, err := result.Result(ctx)
 	if err != nil {
 		return nil, err
 	}
 	return user, nil
 }
 
-func (r *usersRepository) FindOneUserByEmail(email string) (*users.UserCredentialCheck, error) {
+func (r *usersRepository) FindOneUserByEmail(ctx context.Context, email string) (*users.UserCredentialCheck, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	SELECT
 		"id",
@@ -64,15 +108,19 @@ func (r *usersRepository) FindOneUserByEmail(email string) (*users.UserCredentia
 	FROM "users"
 	WHERE "email" = $1;`
 
+	// A user who just signed up may not have reached the replicas yet
 	user := new(users.UserCredentialCheck)
-	if err := r.db.Get(user, query, email); err != nil {
-		return nil, fmt.Errorf("user not found")
+	if err := r.db.Fresh(ctx).GetContext(ctx, user, query, email); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NewNotFound("user not found")
+		}
+		return nil, apperrors.FromDb(err, "find user failed")
 	}
 	return user, nil
 }
 
-func (r *usersRepository) InsertOauth(req *users.UserPassport) error {
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+func (r *usersRepository) InsertOauth(ctx context.Context, req *users.UserPassport) error {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
 	defer cancel()
 
 	query := `
@@ -84,44 +132,57 @@ func (r *usersRepository) InsertOauth(req *users.UserPassport) error {
 	VALUES ($1, $2, $3)
 		RETURNING "id";`
 
-	if err := r.db.QueryRowContext(
+	if err := r.db.Writer(ctx).QueryRowContext(
 		ctx,
 		query,
 		req.User.Id,
 		req.Token.RefreshToken,
 		req.Token.AccessToken,
 	).Scan(&req.Token.Id); err != nil {
-		return fmt.Errorf("insert oauth failed: %v", err)
+		return apperrors.FromDb(err, "insert oauth failed")
 	}
 	return nil
 }
 
-func (r *usersRepository) FindOneOauth(refreshToken string) (*users.Oauth, error) {
+func (r *usersRepository) FindOneOauth(ctx context.Context, refreshToken string) (*users.Oauth, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	SELECT
 		"id",
 		"user_id"
 	FROM "oauth"
 	WHERE "refresh_token" = $1;`
+	// A token issued a moment ago may not have reached the replicas yet
 	oauth := new(users.Oauth)
-	if err := r.db.Get(oauth, query, refreshToken); err != nil {
-		return nil, fmt.Errorf("oauth not found")
+	if err := r.db.Fresh(ctx).GetContext(ctx, oauth, query, refreshToken); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NewNotFound("oauth not found")
+		}
+		return nil, apperrors.FromDb(err, "find oauth failed")
 	}
 	return oauth, nil
 }
 
-func (r *usersRepository) UpdateOauth(req *users.UserToken) error {
+func (r *usersRepository) UpdateOauth(ctx context.Context, req *users.UserToken) error {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	UPDATE "oauth" SET
 		"access_token" = :access_token,
 		"refresh_token" = :refresh_token
 	WHERE "id" = :id;`
-	if _, err := r.db.NamedExecContext(context.Background(), query, req); err != nil {
-		return fmt.Errorf("update oauth failed: %v", err)
+	if _, err := r.db.Writer(ctx).NamedExecContext(ctx, query, req); err != nil {
+		return apperrors.FromDb(err, "update oauth failed")
 	}
 	return nil
 }
-func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
+func (r *usersRepository) GetProfile(ctx context.Context, userId string) (*users.User, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	SELECT
         "id",
@@ -130,24 +191,67 @@ func (r *usersRepository) GetProfile(userId string) (*users.User, error) {
 		"role_id"
 	FROM
     	"users"
-	WHERE 
+	WHERE
     	"id" = $1;`
 
 	profile := new(users.User)
 
-	if err := r.db.Get(profile, query, userId); err != nil {
-		return nil, fmt.Errorf("get user failed: %v", err)
+	if err := r.db.Reader(ctx).GetContext(ctx, profile, query, userId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, apperrors.NewNotFound("user not found")
+		}
+		return nil, apperrors.FromDb(err, "get user failed")
 	}
-	fmt.Printf("check profile %v", profile)
+	r.logger.DebugContext(ctx, "profile found", "profile_id", profile.Id, "role_id", profile.RoleId)
 	return profile, nil
 }
 
-func (r *usersRepository) DeleteOauth(oauthId string) error {
+func (r *usersRepository) DeleteOauth(ctx context.Context, oauthId string) error {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
 	query := `
 	DELETE FROM "oauth" WHERE "id" = $1;
 	`
-	if _, err := r.db.ExecContext(context.Background(), query, oauthId); err != nil {
-		return fmt.Errorf("oauth not found")
+	result, err := r.db.Writer(ctx).ExecContext(ctx, query, oauthId)
+	if err != nil {
+		return apperrors.FromDb(err, "delete oauth failed")
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return apperrors.NewNotFound("oauth not found")
+	}
+	return nil
+}
+
+func (r *usersRepository) UpdatePassword(ctx context.Context, email, password string) (string, error) {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
+	query := `
+	UPDATE "users" SET
+		"password" = $2
+	WHERE "email" = $1
+	RETURNING "id";`
+
+	var userId string
+	if err := r.db.Writer(ctx).QueryRowContext(ctx, query, email, password).Scan(&userId); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", apperrors.NewNotFound("user not found")
+		}
+		return "", apperrors.FromDb(err, "update password failed")
+	}
+	return userId, nil
+}
+
+func (r *usersRepository) DeleteOauthByUserId(ctx context.Context, userId string) error {
+	ctx, cancel := databases.QueryContext(ctx, r.cfg.QueryTimeout())
+	defer cancel()
+
+	query := `
+	DELETE FROM "oauth" WHERE "user_id" = $1;
+	`
+	if _, err := r.db.Writer(ctx).ExecContext(ctx, query, userId); err != nil {
+		return apperrors.FromDb(err, "delete oauth failed")
 	}
 	return nil
 }
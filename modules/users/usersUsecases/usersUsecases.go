@@ -1,59 +1,107 @@
 package usersUsecases
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github/Panyakorn4/kwanjai-shop-tutorial/config"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users/usersRepositories"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
 	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaiauth"
-
-	"golang.org/x/crypto/bcrypt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaimetrics"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaipassword"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
+	"log/slog"
 )
 
 type IUsersUsecase interface {
-	InsertCustomer(req *users.UserRegisterReq) (*users.UserPassport, error)
-	GetPassport(req *users.UserCredential) (*users.UserPassport, error)
-	RefreshPassport(req *users.UserRefreshCredential) (*users.UserPassport, error)
-	DeleteOauth(oauthId string) error
-	GetUserProfile(userId string) (*users.User, error)
+	InsertCustomer(ctx context.Context, req *users.UserRegisterReq) (*users.UserPassport, error)
+	InsertAdmin(ctx context.Context, req *users.UserRegisterReq) (*users.UserPassport, error)
+	GetPassport(ctx context.Context, req *users.UserCredential) (*users.UserPassport, error)
+	RefreshPassport(ctx context.Context, req *users.UserRefreshCredential) (*users.UserPassport, error)
+	DeleteOauth(ctx context.Context, oauthId string) error
+	GetUserProfile(ctx context.Context, userId string) (*users.User, error)
+	ResetPassword(ctx context.Context, req *users.UserCredential) error
 }
 
 type usersUsecase struct {
 	cfg             config.IConfig
+	logger          *slog.Logger
 	usersRepository usersRepositories.IUsersRepository
 }
 
-func UsersUsecase(cfg config.IConfig, usersRepository usersRepositories.IUsersRepository) IUsersUsecase {
+func UsersUsecase(cfg config.IConfig, logger *slog.Logger, usersRepository usersRepositories.IUsersRepository) IUsersUsecase {
 	return &usersUsecase{
 		cfg:             cfg,
+		logger:          kwanjailogger.For(logger, "users"),
 		usersRepository: usersRepository,
 	}
 }
 
-func (u *usersUsecase) InsertCustomer(req *users.UserRegisterReq) (*users.UserPassport, error) {
+// hasher is built per call so a reloaded password config applies at once.
+func (u *usersUsecase) hasher() kwanjaipassword.IHasher {
+	return kwanjaipassword.Hasher(u.cfg.Password())
+}
+
+func errInvalidCredentials() *apperrors.Error {
+	return apperrors.NewUnauthorized("invalid email or password")
+}
+
+func (u *usersUsecase) InsertCustomer(ctx context.Context, req *users.UserRegisterReq) (_ *users.UserPassport, err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.InsertCustomer")
+	defer func() { kwanjaitrace.End(span, err) }()
+
 	// Hashing a password
-	if err := req.BcryptHashing(); err != nil {
+	if err := kwanjaipassword.CheckPolicy(u.cfg.Password(), req.Password, req.Email, req.Username); err != nil {
+		return nil, err
+	}
+	if err := req.HashPassword(u.hasher()); err != nil {
 		return nil, err
 	}
 
 	// Insert user
-	result, err := u.usersRepository.InsertUser(req, false)
+	result, err := u.usersRepository.InsertUser(ctx, req, false)
 	if err != nil {
 		return nil, err
 	}
+	kwanjaimetrics.SignUp("customer")
 	return result, nil
 }
 
-func (u *usersUsecase) GetPassport(req *users.UserCredential) (*users.UserPassport, error) {
-	// Find user
-	user, err := u.usersRepository.FindOneUserByEmail(req.Email)
+func (u *usersUsecase) GetPassport(ctx context.Context, req *users.UserCredential) (_ *users.UserPassport, err error) {
+	defer func() { kwanjaimetrics.SignIn(kwanjaimetrics.Outcome(err)) }()
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.GetPassport")
+	defer func() { kwanjaitrace.End(span, err) }()
+
+	// An unknown email and a wrong password get the same answer, so sign in
+	// does not tell which emails are registered
+	hasher := u.hasher()
+	user, err := u.usersRepository.FindOneUserByEmail(ctx, req.Email)
+	if errors.Is(err, apperrors.ErrNotFound) {
+		// Take as long as checking a password would
+		hasher.Hash(req.Password)
+		return nil, errInvalidCredentials()
+	}
 	if err != nil {
 		return nil, err
 	}
 
 	// Compare password
-	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
-		return nil, fmt.Errorf("password is invalid")
+	ok, err := hasher.Verify(user.Password, req.Password)
+	if err != nil {
+		return nil, apperrors.NewInternal(err, "verify password failed")
+	}
+	if !ok {
+		return nil, errInvalidCredentials()
+	}
+
+	// Upgrade an outdated hash while the plain password is at hand, a failure
+	// here must not block the sign in
+	if hasher.NeedsRehash(user.Password) {
+		if err := u.rehash(ctx, hasher, user.Email, req.Password); err != nil {
+			u.logger.WarnContext(ctx, "rehash password failed", "user_id", user.Id, "error", err)
+		}
 	}
 
 	// Sign token
@@ -79,13 +127,17 @@ func (u *usersUsecase) GetPassport(req *users.UserCredential) (*users.UserPasspo
 			RefreshToken: refreshToken.SignToken(),
 		},
 	}
-	if err := u.usersRepository.InsertOauth(passport); err != nil {
+	if err := u.usersRepository.InsertOauth(ctx, passport); err != nil {
 		return nil, err
 	}
 	return passport, nil
 }
 
-func (u *usersUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users.UserPassport, error) {
+func (u *usersUsecase) RefreshPassport(ctx context.Context, req *users.UserRefreshCredential) (_ *users.UserPassport, err error) {
+	defer func() { kwanjaimetrics.Refresh(kwanjaimetrics.Outcome(err)) }()
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.RefreshPassport")
+	defer func() { kwanjaitrace.End(span, err) }()
+
 	// Parse token
 	claims, err := kwanjaiauth.ParseToken(u.cfg.Jwt(), req.RefreshToken)
 	if err != nil {
@@ -93,17 +145,17 @@ func (u *usersUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users
 	}
 
 	// Check oauth
-	oauth, err := u.usersRepository.FindOneOauth(req.RefreshToken)
+	oauth, err := u.usersRepository.FindOneOauth(ctx, req.RefreshToken)
 	if err != nil {
 		return nil, err
 	}
 
 	// Find profile
-	profile, err := u.usersRepository.GetProfile(oauth.UserId)
+	profile, err := u.usersRepository.GetProfile(ctx, oauth.UserId)
 	if err != nil {
 		return nil, err
 	}
-	fmt.Printf("check user_id %v", profile)
+	u.logger.DebugContext(ctx, "refresh passport", "user_id", profile.Id, "oauth_id", oauth.Id)
 
 	newClaims := &users.UserClaims{
 		Id:     profile.Id,
@@ -132,37 +184,83 @@ func (u *usersUsecase) RefreshPassport(req *users.UserRefreshCredential) (*users
 			RefreshToken: refreshToken,
 		},
 	}
-	if err := u.usersRepository.UpdateOauth(passport.Token); err != nil {
+	if err := u.usersRepository.UpdateOauth(ctx, passport.Token); err != nil {
 		return nil, err
 	}
 	return passport, nil
 }
 
-func (u *usersUsecase) DeleteOauth(oauthId string) error {
-	if err := u.usersRepository.DeleteOauth(oauthId); err != nil {
+func (u *usersUsecase) DeleteOauth(ctx context.Context, oauthId string) (err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.DeleteOauth")
+	defer func() { kwanjaitrace.End(span, err) }()
+
+	if err := u.usersRepository.DeleteOauth(ctx, oauthId); err != nil {
 		return err
 	}
 	return nil
 }
 
-func (u *usersUsecase) InsertAdmin(req *users.UserRegisterReq) (*users.UserPassport, error) {
+func (u *usersUsecase) InsertAdmin(ctx context.Context, req *users.UserRegisterReq) (_ *users.UserPassport, err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.InsertAdmin")
+	defer func() { kwanjaitrace.End(span, err) }()
+
 	// Hashing a password
-	if err := req.BcryptHashing(); err != nil {
+	if err := kwanjaipassword.CheckPolicy(u.cfg.Password(), req.Password, req.Email, req.Username); err != nil {
+		return nil, err
+	}
+	if err := req.HashPassword(u.hasher()); err != nil {
 		return nil, err
 	}
 
 	// Insert user
-	result, err := u.usersRepository.InsertUser(req, true)
+	result, err := u.usersRepository.InsertUser(ctx, req, true)
 	if err != nil {
 		return nil, err
 	}
+	kwanjaimetrics.SignUp("admin")
 	return result, nil
 }
 
-func (u *usersUsecase) GetUserProfile(userId string) (*users.User, error) {
-	profile, err := u.usersRepository.GetProfile(userId)
+func (u *usersUsecase) GetUserProfile(ctx context.Context, userId string) (_ *users.User, err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.GetUserProfile")
+	defer func() { kwanjaitrace.End(span, err) }()
+
+	profile, err := u.usersRepository.GetProfile(ctx, userId)
 	if err != nil {
 		return nil, err
 	}
 	return profile, nil
 }
+
+func (u *usersUsecase) rehash(ctx context.Context, hasher kwanjaipassword.IHasher, email, password string) error {
+	hashed, err := hasher.Hash(password)
+	if err != nil {
+		return err
+	}
+	_, err = u.usersRepository.UpdatePassword(ctx, email, hashed)
+	return err
+}
+
+// ResetPassword sets a new password and signs the user out everywhere.
+func (u *usersUsecase) ResetPassword(ctx context.Context, req *users.UserCredential) (err error) {
+	ctx, span := kwanjaitrace.Start(ctx, "usersUsecase.ResetPassword")
+	defer func() { kwanjaitrace.End(span, err) }()
+
+	if err := kwanjaipassword.CheckPolicy(u.cfg.Password(), req.Password, req.Email, ""); err != nil {
+		return err
+	}
+	hashing := &users.UserRegisterReq{
+		Password: req.Password,
+	}
+	if err := hashing.HashPassword(u.hasher()); err != nil {
+		return err
+	}
+
+	return u.usersRepository.WithTx(ctx, func(repo usersRepositories.IUsersRepository) error {
+		userId, err := repo.UpdatePassword(ctx, req.Email, hashing.Password)
+		if err != nil {
+			return err
+		}
+		return repo.DeleteOauthByUserId(ctx, userId)
+	})
+}
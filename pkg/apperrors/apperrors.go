@@ -0,0 +1,195 @@
+package apperrors
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Kind says what went wrong in terms a client can act on, each kind maps to
+// one HTTP status.
+type Kind int
+
+const (
+	Internal Kind = iota
+	NotFound
+	Conflict
+	Validation
+	Unauthorized
+)
+
+func (k Kind) String() string {
+	switch k {
+	case NotFound:
+		return "not found"
+	case Conflict:
+		return "conflict"
+	case Validation:
+		return "validation"
+	case Unauthorized:
+		return "unauthorized"
+	default:
+		return "internal"
+	}
+}
+
+// Status maps a kind to its HTTP status code.
+func (k Kind) Status() int {
+	switch k {
+	case NotFound:
+		return http.StatusNotFound
+	case Conflict:
+		return http.StatusConflict
+	case Validation:
+		return http.StatusBadRequest
+	case Unauthorized:
+		return http.StatusUnauthorized
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// Error is a domain error. Msg is safe to show to the client, Err keeps the
+// cause for the logs and for errors.Is/As, it never reaches the client. Code is the handler error code
+// (e.g. users-001) when the layer that raised the error already knows it.
+// Fields lists the offending inputs of a Validation error.
+type Error struct {
+	Kind   Kind
+	Code   string
+	Msg    string
+	Err    error
+	Fields []*FieldError
+}
+
+// FieldError is one invalid input, Field is its name as the client sent it
+// and Rule the check it failed.
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Sentinels for errors.Is, an *Error matches the sentinel of its kind.
+var (
+	ErrInternal     = &Error{Kind: Internal, Msg: "internal error"}
+	ErrNotFound     = &Error{Kind: NotFound, Msg: "not found"}
+	ErrConflict     = &Error{Kind: Conflict, Msg: "conflict"}
+	ErrValidation   = &Error{Kind: Validation, Msg: "validation failed"}
+	ErrUnauthorized = &Error{Kind: Unauthorized, Msg: "unauthorized"}
+)
+
+// Error is the message followed by the cause, for the logs. MessageOf is
+// what the client gets.
+func (e *Error) Error() string {
+	switch {
+	case e.Err == nil:
+		return e.Msg
+	case e.Msg == "":
+		return e.Err.Error()
+	}
+	return e.Msg + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	if !ok {
+		return false
+	}
+	switch t {
+	case ErrInternal, ErrNotFound, ErrConflict, ErrValidation, ErrUnauthorized:
+		return e.Kind == t.Kind
+	}
+	return e == t
+}
+
+// WithCode returns a copy of e carrying the handler error code.
+func (e *Error) WithCode(code string) *Error {
+	c := *e
+	c.Code = code
+	return &c
+}
+
+func New(kind Kind, format string, args ...any) *Error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...)}
+}
+
+// Wrap keeps err as the cause behind a client facing message.
+func Wrap(kind Kind, err error, format string, args ...any) *Error {
+	return &Error{Kind: kind, Msg: fmt.Sprintf(format, args...), Err: err}
+}
+
+func NewNotFound(format string, args ...any) *Error {
+	return New(NotFound, format, args...)
+}
+
+func NewConflict(format string, args ...any) *Error {
+	return New(Conflict, format, args...)
+}
+
+func NewValidation(format string, args ...any) *Error {
+	return New(Validation, format, args...)
+}
+
+func NewUnauthorized(format string, args ...any) *Error {
+	return New(Unauthorized, format, args...)
+}
+
+// NewInternal wraps an unexpected failure, err is kept as the cause only.
+func NewInternal(err error, format string, args ...any) *Error {
+	return Wrap(Internal, err, format, args...)
+}
+
+// NewFieldsValidation is a Validation error listing the invalid fields.
+func NewFieldsValidation(fields []*FieldError) *Error {
+	e := New(Validation, "validation failed")
+	e.Fields = fields
+	return e
+}
+
+// KindOf returns the kind of the first *Error in err's chain, Internal when
+// there is none.
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return Internal
+}
+
+// internalMsg is all the client learns of an Internal error.
+const internalMsg = "internal server error"
+
+// MessageOf is the message safe to show to the client for err. Internal
+// errors and errors that are not an *Error get a generic message.
+func MessageOf(err error) string {
+	var e *Error
+	if errors.As(err, &e) && e.Kind != Internal && e.Msg != "" {
+		return e.Msg
+	}
+	return internalMsg
+}
+
+// Status is the HTTP status for err.
+func Status(err error) int {
+	return KindOf(err).Status()
+}
+
+// CodeOf returns the error code carried by err, or fallback.
+func CodeOf(err error, fallback string) string {
+	var e *Error
+	if errors.As(err, &e) && e.Code != "" {
+		return e.Code
+	}
+	return fallback
+}
+
+// FieldsOf returns the field errors carried by err.
+func FieldsOf(err error) []*FieldError {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Fields
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package apperrors
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Postgres SQLSTATE codes the repositories react to.
+const (
+	PgUniqueViolation     = "23505"
+	PgForeignKeyViolation = "23503"
+	PgNotNullViolation    = "23502"
+	PgCheckViolation      = "23514"
+	PgInvalidText         = "22P02"
+)
+
+// PgError returns the *pgconn.PgError in err's chain.
+func PgError(err error) (*pgconn.PgError, bool) {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr, true
+	}
+	return nil, false
+}
+
+// IsConstraint reports whether err is a violation of the named constraint.
+func IsConstraint(err error, code, constraint string) bool {
+	pgErr, ok := PgError(err)
+	return ok && pgErr.Code == code && pgErr.ConstraintName == constraint
+}
+
+// FromDb classifies a database error: no rows is NotFound, constraint
+// violations and malformed input are Conflict or Validation, anything else is
+// Internal. msg is the client message, err stays the cause. Repositories
+// that want a friendlier message check the case first.
+func FromDb(err error, msg string) *Error {
+	e := NewInternal(err, "%s", msg)
+	if errors.Is(err, sql.ErrNoRows) {
+		e.Kind = NotFound
+	} else if pgErr, ok := PgError(err); ok {
+		switch pgErr.Code {
+		case PgUniqueViolation:
+			e.Kind = Conflict
+		case PgForeignKeyViolation, PgNotNullViolation, PgCheckViolation, PgInvalidText:
+			e.Kind = Validation
+		}
+	}
+	return e
+}
@@ -0,0 +1,198 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"sync/atomic"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// IRouter picks the connection a repository query runs on. Writer always
+// returns the primary, Reader may return a replica. Fresh is for reads that
+// cannot tolerate replica lag, such as a token issued a moment ago.
+type IRouter interface {
+	Reader(ctx context.Context) IQueryer
+	Writer(ctx context.Context) IQueryer
+	Fresh(ctx context.Context) IQueryer
+}
+
+// ICluster is the primary with its read replicas.
+type ICluster interface {
+	IRouter
+	Primary() *sqlx.DB
+	// Stats returns the pool stats of the primary and of every replica, by name.
+	Stats() map[string]sql.DBStats
+	Close() error
+}
+
+type cluster struct {
+	primary  *sqlx.DB
+	replicas []*replica
+	next     atomic.Uint64
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+type replica struct {
+	name    string
+	db      *sqlx.DB
+	healthy atomic.Bool
+}
+
+// Cluster opens the replicas of cfg next to an already connected primary.
+// A replica that is down at boot is not an error, it only gets no reads
+// until a health check reaches it.
+func Cluster(cfg config.IDbConfig, primary *sqlx.DB) (ICluster, error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &cluster{
+		primary: primary,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+	for i, url := range cfg.ReplicaUrls() {
+		db, err := open(cfg, url)
+		if err != nil {
+			cancel()
+			c.closeReplicas()
+			return nil, err
+		}
+		c.replicas = append(c.replicas, &replica{
+			name: fmt.Sprintf("replica %d", i+1),
+			db:   db,
+		})
+	}
+
+	c.check(ctx, cfg.ReplicaCheckInterval())
+	go c.watch(ctx, cfg.ReplicaCheckInterval())
+	return c, nil
+}
+
+func (c *cluster) Primary() *sqlx.DB { return c.primary }
+
+func (c *cluster) Stats() map[string]sql.DBStats {
+	stats := map[string]sql.DBStats{
+		"primary": c.primary.Stats(),
+	}
+	for _, r := range c.replicas {
+		stats[r.name] = r.db.Stats()
+	}
+	return stats
+}
+
+// Writer returns the primary and marks the request session, so its later
+// reads see what it wrote.
+func (c *cluster) Writer(ctx context.Context) IQueryer {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok {
+		s.wrote.Store(true)
+	}
+	return c.primary
+}
+
+// Fresh returns the primary without marking the request session, so the
+// reads after it may still go to a replica.
+func (c *cluster) Fresh(ctx context.Context) IQueryer {
+	return c.primary
+}
+
+// Reader returns the next healthy replica, round robin. It falls back to the
+// primary when no replica is healthy or the request has written already.
+func (c *cluster) Reader(ctx context.Context) IQueryer {
+	if s, ok := ctx.Value(sessionKey{}).(*session); ok && s.wrote.Load() {
+		return c.primary
+	}
+	n := uint64(len(c.replicas))
+	if n == 0 {
+		return c.primary
+	}
+	start := c.next.Add(1)
+	for i := uint64(0); i < n; i++ {
+		if r := c.replicas[(start+i)%n]; r.healthy.Load() {
+			return r.db
+		}
+	}
+	return c.primary
+}
+
+func (c *cluster) watch(ctx context.Context, interval time.Duration) {
+	defer close(c.done)
+	if len(c.replicas) == 0 {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.check(ctx, interval)
+		}
+	}
+}
+
+// check pings every replica and ejects or readmits it on a state change.
+func (c *cluster) check(ctx context.Context, timeout time.Duration) {
+	for _, r := range c.replicas {
+		pingCtx, cancel := context.WithTimeout(ctx, timeout)
+		err := r.db.PingContext(pingCtx)
+		cancel()
+
+		healthy := err == nil
+		if r.healthy.Swap(healthy) == healthy {
+			continue
+		}
+		if healthy {
+			logger().InfoContext(ctx, "replica is healthy, sending reads to it", "replica", r.name)
+		} else {
+			logger().WarnContext(ctx, "replica is down, sending its reads elsewhere", "replica", r.name, "error", err)
+		}
+	}
+}
+
+func (c *cluster) closeReplicas() error {
+	var errs []error
+	for _, r := range c.replicas {
+		if err := r.db.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close %s failed: %v", r.name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Close stops the health checks and closes the replicas, the primary is
+// left to whoever connected it.
+func (c *cluster) Close() error {
+	c.cancel()
+	<-c.done
+	return c.closeReplicas()
+}
+
+type sessionKey struct{}
+
+type session struct {
+	wrote atomic.Bool
+}
+
+// WithSession scopes read-your-writes to ctx, typically one HTTP request:
+// once a query of the session went to the primary, its reads stay there.
+func WithSession(ctx context.Context) context.Context {
+	return context.WithValue(ctx, sessionKey{}, &session{})
+}
+
+// Single routes reads and writes to q, for a plain *sqlx.DB or a transaction.
+func Single(q IQueryer) IRouter {
+	return single{q: q}
+}
+
+type single struct {
+	q IQueryer
+}
+
+func (s single) Reader(ctx context.Context) IQueryer { return s.q }
+func (s single) Writer(ctx context.Context) IQueryer { return s.q }
+func (s single) Fresh(ctx context.Context) IQueryer  { return s.q }
@@ -1,19 +1,103 @@
 package databases
 
 import (
+	"context"
+	"database/sql/driver"
+	"fmt"
 	"github/Panyakorn4/kwanjai-shop-tutorial/config"
-	"log"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjailogger"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaitrace"
+	"log/slog"
+	"time"
 
+	"github.com/XSAM/otelsql"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
 )
 
-func DbConnect(cfg config.IDbConfig) *sqlx.DB {
-	//connect
-	db, err := sqlx.Connect("pgx", cfg.Url())
+const (
+	connectBackoffMin = 500 * time.Millisecond
+	connectBackoffMax = 5 * time.Second
+)
+
+// logger is looked up on every call so it follows slog.SetDefault.
+func logger() *slog.Logger {
+	return kwanjailogger.For(slog.Default(), "databases")
+}
+
+// DbConnect opens the pool and pings the database. Postgres may still be
+// starting next to the app, so failed attempts are retried with a growing
+// backoff for up to the configured connect timeout.
+func DbConnect(ctx context.Context, cfg config.IDbConfig) (*sqlx.DB, error) {
+	db, err := open(cfg, cfg.Url())
 	if err != nil {
-		log.Fatalf("connect to db failed: %v\n", err)
+		return nil, err
+	}
+	if err := ping(ctx, db, cfg.ConnectTimeout()); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// open creates a pool with the configured limits, it does not connect yet.
+// Every query gets a span carrying its sanitized statement.
+func open(cfg config.IDbConfig, url string) (*sqlx.DB, error) {
+	conn, err := otelsql.Open("pgx", url,
+		otelsql.WithAttributes(semconv.DBSystemPostgreSQL),
+		otelsql.WithSpanOptions(otelsql.SpanOptions{
+			DisableQuery:         true,
+			DisableErrSkip:       true,
+			OmitConnResetSession: true,
+			OmitRows:             true,
+		}),
+		otelsql.WithAttributesGetter(func(_ context.Context, _ otelsql.Method, query string, _ []driver.NamedValue) []attribute.KeyValue {
+			if query == "" {
+				return nil
+			}
+			return []attribute.KeyValue{semconv.DBStatement(kwanjaitrace.SanitizeSql(query))}
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("open db failed: %v", err)
+	}
+	db := sqlx.NewDb(conn, "pgx")
+	db.SetMaxOpenConns(cfg.MaxOpenConns())
+	db.SetMaxIdleConns(cfg.MaxIdleConns())
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime())
+	db.SetConnMaxIdleTime(cfg.ConnMaxIdleTime())
+	return db, nil
+}
+
+func ping(ctx context.Context, db *sqlx.DB, window time.Duration) error {
+	deadline := time.Now().Add(window)
+	backoff := connectBackoffMin
+	for attempt := 1; ; attempt++ {
+		pingCtx, cancel := context.WithTimeout(ctx, connectBackoffMax)
+		err := db.PingContext(pingCtx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 {
+			return fmt.Errorf("connect to db failed after %d attempt(s): %v", attempt, err)
+		}
+		if backoff < wait {
+			wait = backoff
+		}
+		logger().WarnContext(ctx, "connect to db failed, retrying", "attempt", attempt, "wait", wait, "error", err)
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("connect to db failed: %v", ctx.Err())
+		case <-time.After(wait):
+		}
+		backoff *= 2
+		if backoff > connectBackoffMax {
+			backoff = connectBackoffMax
+		}
 	}
-	db.DB.SetMaxOpenConns(cfg.MaxOpenConns())
-	return db
 }
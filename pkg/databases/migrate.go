@@ -0,0 +1,389 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// MigrationsDir is where `migrate create` writes new files, relative to the repository root.
+const MigrationsDir = "pkg/databases/migrations"
+
+// migrationsTable records the applied migrations. It is not named
+// schema_migrations, golang-migrate keeps its own (version, dirty) table
+// under that name.
+const migrationsTable = "kwanjai_migrations"
+
+// legacyMigrationsTable is the table of golang-migrate, a database it
+// migrated is adopted by the first run of this runner.
+const legacyMigrationsTable = "schema_migrations"
+
+// migrationLockId is the key of the advisory lock held while migrating,
+// so two instances booting at once cannot apply the same migration twice.
+const migrationLockId = 4243747110
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+var (
+	migrationFileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+	beginRegexp         = regexp.MustCompile(`(?i)^\s*BEGIN\s*;`)
+	commitRegexp        = regexp.MustCompile(`(?i)COMMIT\s*;\s*$`)
+)
+
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+type MigrationStatus struct {
+	Version   int        `db:"version"`
+	Name      string     `db:"name"`
+	Applied   bool       `db:"-"`
+	AppliedAt *time.Time `db:"applied_at"`
+}
+
+type IMigrator interface {
+	Up(ctx context.Context, n int) error
+	Down(ctx context.Context, n int) error
+	Status(ctx context.Context) ([]*MigrationStatus, error)
+	// Version returns the highest applied and the highest known migration
+	// without taking the migration lock, so it is cheap enough for probes.
+	Version(ctx context.Context) (applied, latest int, err error)
+}
+
+type migrator struct {
+	db         *sqlx.DB
+	migrations []*Migration
+}
+
+func Migrator(db *sqlx.DB) (IMigrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{
+		db:         db,
+		migrations: migrations,
+	}, nil
+}
+
+func loadMigrations(fsys fs.FS, dir string) ([]*Migration, error) {
+	files, err := fs.Glob(fsys, path.Join(dir, "*.sql"))
+	if err != nil {
+		return nil, fmt.Errorf("list migrations failed: %v", err)
+	}
+
+	byVersion := make(map[int]*Migration)
+	for _, file := range files {
+		match := migrationFileRegexp.FindStringSubmatch(filepath.Base(file))
+		if match == nil {
+			return nil, fmt.Errorf("migration filename %s is invalid", file)
+		}
+		version, _ := strconv.Atoi(match[1])
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s failed: %v", file, err)
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{
+				Version: version,
+				Name:    match[2],
+			}
+			byVersion[version] = m
+		}
+		if match[3] == "up" {
+			m.Up = string(data)
+		} else {
+			m.Down = string(data)
+		}
+	}
+
+	migrations := make([]*Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		migrations = append(migrations, m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// withLock runs fn on a single connection holding the migration advisory lock.
+func (m *migrator) withLock(ctx context.Context, fn func(conn *sqlx.Conn) error) error {
+	conn, err := m.db.Connx(ctx)
+	if err != nil {
+		return fmt.Errorf("get connection failed: %v", err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1);`, migrationLockId); err != nil {
+		return fmt.Errorf("lock migrations failed: %v", err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1);`, migrationLockId)
+
+	query := `
+	CREATE TABLE IF NOT EXISTS "kwanjai_migrations" (
+		"version" BIGINT PRIMARY KEY,
+		"name" VARCHAR NOT NULL,
+		"applied_at" TIMESTAMP NOT NULL DEFAULT now()
+	);`
+	if _, err := conn.ExecContext(ctx, query); err != nil {
+		return fmt.Errorf("create %s failed: %v", migrationsTable, err)
+	}
+	if err := m.adoptLegacy(ctx, conn); err != nil {
+		return err
+	}
+	return fn(conn)
+}
+
+// legacyVersion reads the version golang-migrate left in schema_migrations.
+// ok is false when there is no such table, or it is not golang-migrate's.
+func legacyVersion(ctx context.Context, q sqlx.QueryerContext) (version int, dirty, ok bool, err error) {
+	query := `
+	SELECT
+		count(*) = 2
+	FROM "information_schema"."columns"
+	WHERE "table_schema" = current_schema()
+	AND "table_name" = $1
+	AND "column_name" IN ('version', 'dirty');`
+
+	if err := sqlx.GetContext(ctx, q, &ok, query, legacyMigrationsTable); err != nil {
+		return 0, false, false, fmt.Errorf("find %s failed: %v", legacyMigrationsTable, err)
+	}
+	if !ok {
+		return 0, false, false, nil
+	}
+
+	row := q.QueryRowxContext(ctx, `SELECT "version", "dirty" FROM "schema_migrations" LIMIT 1;`)
+	if err := row.Scan(&version, &dirty); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, false, false, nil
+		}
+		return 0, false, false, fmt.Errorf("get %s version failed: %v", legacyMigrationsTable, err)
+	}
+	return version, dirty, true, nil
+}
+
+// adoptLegacy records every migration up to golang-migrate's version as
+// applied, once, so a database migrated by it is not migrated again.
+func (m *migrator) adoptLegacy(ctx context.Context, conn *sqlx.Conn) error {
+	var empty bool
+	if err := conn.GetContext(ctx, &empty, `SELECT NOT EXISTS (SELECT 1 FROM "kwanjai_migrations");`); err != nil {
+		return fmt.Errorf("get applied migrations failed: %v", err)
+	}
+	if !empty {
+		return nil
+	}
+
+	version, dirty, ok, err := legacyVersion(ctx, conn)
+	if err != nil || !ok {
+		return err
+	}
+	if dirty {
+		return fmt.Errorf("%s is dirty at version %d, fix it with golang-migrate before migrating", legacyMigrationsTable, version)
+	}
+	for _, mig := range m.migrations {
+		if mig.Version > version {
+			break
+		}
+		if _, err := conn.ExecContext(ctx, `INSERT INTO "kwanjai_migrations" ("version", "name") VALUES ($1, $2);`, mig.Version, mig.Name); err != nil {
+			return fmt.Errorf("adopt migration %06d_%s failed: %v", mig.Version, mig.Name, err)
+		}
+	}
+	return nil
+}
+
+func appliedVersions(ctx context.Context, conn *sqlx.Conn) (map[int]*MigrationStatus, error) {
+	query := `
+	SELECT
+		"version",
+		"name",
+		"applied_at"
+	FROM "kwanjai_migrations";`
+
+	rows := make([]*MigrationStatus, 0)
+	if err := conn.SelectContext(ctx, &rows, query); err != nil {
+		return nil, fmt.Errorf("get applied migrations failed: %v", err)
+	}
+	applied := make(map[int]*MigrationStatus)
+	for _, r := range rows {
+		r.Applied = true
+		applied[r.Version] = r
+	}
+	return applied, nil
+}
+
+// stripTransaction removes the BEGIN/COMMIT wrapping a file, the runner
+// applies each file in its own transaction together with its version row.
+func stripTransaction(sql string) string {
+	sql = beginRegexp.ReplaceAllString(sql, "")
+	return commitRegexp.ReplaceAllString(sql, "")
+}
+
+func (m *migrator) apply(ctx context.Context, conn *sqlx.Conn, sql string, record func(tx *sqlx.Tx) error) error {
+	tx, err := conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, stripTransaction(sql)); err != nil {
+		tx.Rollback()
+		return err
+	}
+	if err := record(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// Up applies the next n pending migrations, or all of them when n <= 0.
+func (m *migrator) Up(ctx context.Context, n int) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for _, mig := range m.migrations {
+			if n > 0 && count >= n {
+				break
+			}
+			if _, ok := applied[mig.Version]; ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig.Up, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, `INSERT INTO "kwanjai_migrations" ("version", "name") VALUES ($1, $2);`, mig.Version, mig.Name)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migrate up %06d_%s failed: %v", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+}
+
+// Down rolls back the last n applied migrations, or all of them when n <= 0.
+func (m *migrator) Down(ctx context.Context, n int) error {
+	return m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+
+		count := 0
+		for i := len(m.migrations) - 1; i >= 0; i-- {
+			mig := m.migrations[i]
+			if n > 0 && count >= n {
+				break
+			}
+			if _, ok := applied[mig.Version]; !ok {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig.Down, func(tx *sqlx.Tx) error {
+				_, err := tx.ExecContext(ctx, `DELETE FROM "kwanjai_migrations" WHERE "version" = $1;`, mig.Version)
+				return err
+			}); err != nil {
+				return fmt.Errorf("migrate down %06d_%s failed: %v", mig.Version, mig.Name, err)
+			}
+			count++
+		}
+		return nil
+	})
+}
+
+func (m *migrator) Status(ctx context.Context) ([]*MigrationStatus, error) {
+	status := make([]*MigrationStatus, 0, len(m.migrations))
+	err := m.withLock(ctx, func(conn *sqlx.Conn) error {
+		applied, err := appliedVersions(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range m.migrations {
+			if s, ok := applied[mig.Version]; ok {
+				status = append(status, s)
+				continue
+			}
+			status = append(status, &MigrationStatus{
+				Version: mig.Version,
+				Name:    mig.Name,
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return status, nil
+}
+
+func (m *migrator) Version(ctx context.Context) (int, int, error) {
+	latest := 0
+	if n := len(m.migrations); n > 0 {
+		latest = m.migrations[n-1].Version
+	}
+
+	// The table only exists once a migration ran, until then a database
+	// golang-migrate migrated reports its version
+	var exists bool
+	if err := m.db.GetContext(ctx, &exists, `SELECT to_regclass('"kwanjai_migrations"') IS NOT NULL;`); err != nil {
+		return 0, latest, fmt.Errorf("get schema version failed: %v", err)
+	}
+	if !exists {
+		version, dirty, ok, err := legacyVersion(ctx, m.db)
+		if err != nil || !ok || dirty {
+			return 0, latest, err
+		}
+		return version, latest, nil
+	}
+	var applied int
+	if err := m.db.GetContext(ctx, &applied, `SELECT COALESCE(MAX("version"), 0) FROM "kwanjai_migrations";`); err != nil {
+		return 0, latest, fmt.Errorf("get schema version failed: %v", err)
+	}
+	return applied, latest, nil
+}
+
+// CreateMigration writes an empty up/down pair numbered after the last file in dir.
+func CreateMigration(dir, name string) ([]string, error) {
+	name = strings.ToLower(strings.Join(strings.Fields(name), "_"))
+	if name == "" {
+		return nil, fmt.Errorf("migration name is required")
+	}
+
+	migrations, err := loadMigrations(os.DirFS(dir), ".")
+	if err != nil {
+		return nil, err
+	}
+	next := 1
+	if len(migrations) > 0 {
+		next = migrations[len(migrations)-1].Version + 1
+	}
+
+	files := make([]string, 0, 2)
+	for _, direction := range []string{"up", "down"} {
+		file := filepath.Join(dir, fmt.Sprintf("%06d_%s.%s.sql", next, name, direction))
+		if err := os.WriteFile(file, []byte("BEGIN;\n\nCOMMIT;\n"), 0644); err != nil {
+			return nil, fmt.Errorf("create migration failed: %v", err)
+		}
+		files = append(files, file)
+	}
+	return files, nil
+}
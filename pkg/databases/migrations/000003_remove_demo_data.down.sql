@@ -0,0 +1,5 @@
+BEGIN;
+
+--The demo data is not put back, apply it with `seed demo`.
+
+COMMIT;
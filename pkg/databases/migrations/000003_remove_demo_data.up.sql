@@ -0,0 +1,23 @@
+BEGIN;
+
+--Remove the demo data 000002 inserted, it is seeded with `seed demo` now.
+--Orders, oauth and images go with their users and products.
+DELETE FROM "users"
+WHERE "email" IN ('customer001@kawaii.com', 'admin001@kawaii.com');
+
+DELETE FROM "products"
+WHERE ("id", "title", "description") IN (
+    ('P000001', 'Coffee', 'Just a food & beverage product'),
+    ('P000002', 'Steak', 'Just a food & beverage product'),
+    ('P000003', 'Shirt', 'Just a fashion product'),
+    ('P000004', 'Touser', 'Just a fashion product'),
+    ('P000005', 'Phone', 'Just a gadget product'),
+    ('P000006', 'Computer', 'Just a gadget product')
+);
+
+--Keep a demo category a real product was put in
+DELETE FROM "categories"
+WHERE "title" IN ('food & beverage', 'fashion', 'gadget')
+AND "id" NOT IN (SELECT "category_id" FROM "products_categories");
+
+COMMIT;
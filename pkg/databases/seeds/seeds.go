@@ -0,0 +1,387 @@
+package seeds
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/databases"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaipassword"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed fixtures/*
+var fixtureFiles embed.FS
+
+// Fixture is one seed data set, JSON files use the same field names.
+type Fixture struct {
+	Users      []*FixtureUser    `yaml:"users" json:"users"`
+	Categories []string          `yaml:"categories" json:"categories"`
+	Products   []*FixtureProduct `yaml:"products" json:"products"`
+	Orders     []*FixtureOrder   `yaml:"orders" json:"orders"`
+}
+
+type FixtureUser struct {
+	Username string `yaml:"username" json:"username"`
+	Email    string `yaml:"email" json:"email"`
+	Password string `yaml:"password" json:"password"` // plain text, hashed while seeding
+	Role     string `yaml:"role" json:"role"`
+}
+
+type FixtureProduct struct {
+	Id          string          `yaml:"id" json:"id"`
+	Title       string          `yaml:"title" json:"title"`
+	Description string          `yaml:"description" json:"description"`
+	Price       float64         `yaml:"price" json:"price"`
+	Category    string          `yaml:"category" json:"category"`
+	Images      []*FixtureImage `yaml:"images" json:"images"`
+}
+
+type FixtureImage struct {
+	Id       string `yaml:"id" json:"id"`
+	Filename string `yaml:"filename" json:"filename"`
+	Url      string `yaml:"url" json:"url"`
+}
+
+type FixtureOrder struct {
+	Id           string                 `yaml:"id" json:"id"`
+	User         string                 `yaml:"user" json:"user"` // email of the buyer
+	Contact      string                 `yaml:"contact" json:"contact"`
+	Address      string                 `yaml:"address" json:"address"`
+	Status       string                 `yaml:"status" json:"status"`
+	TransferSlip map[string]any         `yaml:"transfer_slip" json:"transfer_slip"`
+	Products     []*FixtureOrderProduct `yaml:"products" json:"products"`
+}
+
+type FixtureOrderProduct struct {
+	Product string `yaml:"product" json:"product"` // product id
+	Qty     int    `yaml:"qty" json:"qty"`
+}
+
+// Profiles lists the fixture sets built into the binary.
+func Profiles() []string {
+	files, _ := fs.Glob(fixtureFiles, "fixtures/*")
+	profiles := make([]string, 0, len(files))
+	for _, f := range files {
+		base := path.Base(f)
+		profiles = append(profiles, strings.TrimSuffix(base, path.Ext(base)))
+	}
+	sort.Strings(profiles)
+	return profiles
+}
+
+// LoadProfile reads a built-in fixture set such as demo, e2e or empty.
+func LoadProfile(profile string) (*Fixture, error) {
+	for _, ext := range []string{".yaml", ".yml", ".json"} {
+		data, err := fixtureFiles.ReadFile("fixtures/" + profile + ext)
+		if err == nil {
+			return parseFixture(data)
+		}
+	}
+	return nil, fmt.Errorf("seed profile %q not found, available: %s", profile, strings.Join(Profiles(), ", "))
+}
+
+// LoadFile reads a fixture set from a YAML or JSON file on disk.
+func LoadFile(file string) (*Fixture, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read fixture failed: %v", err)
+	}
+	return parseFixture(data)
+}
+
+// JSON is a subset of YAML, so one decoder handles both formats.
+func parseFixture(data []byte) (*Fixture, error) {
+	fixture := new(Fixture)
+	if err := yaml.Unmarshal(data, fixture); err != nil {
+		return nil, fmt.Errorf("parse fixture failed: %v", err)
+	}
+	return fixture, nil
+}
+
+// Seed upserts every row of the fixture in a single transaction, running it
+// again updates the rows in place instead of duplicating them. Passwords are
+// hashed by hasher but skip the password policy, fixtures may use weak ones.
+func Seed(ctx context.Context, db *sqlx.DB, hasher kwanjaipassword.IHasher, fixture *Fixture) error {
+	return databases.WithTx(ctx, db, func(tx *sqlx.Tx) error {
+		s := &seeder{
+			ctx:        ctx,
+			tx:         tx,
+			hasher:     hasher,
+			fixture:    fixture,
+			categories: make(map[string]int),
+			users:      make(map[string]string),
+		}
+		return s.run()
+	})
+}
+
+type seeder struct {
+	ctx        context.Context
+	tx         *sqlx.Tx
+	hasher     kwanjaipassword.IHasher
+	fixture    *Fixture
+	categories map[string]int    // title -> id
+	users      map[string]string // email -> id
+}
+
+func (s *seeder) run() error {
+	steps := []func() error{
+		s.seedUsers,
+		s.seedCategories,
+		s.seedProducts,
+		s.seedOrders,
+		s.syncSequences,
+	}
+	for _, step := range steps {
+		if err := step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *seeder) seedUsers() error {
+	roles := make(map[string]int)
+	rows := make([]*struct {
+		Id    int    `db:"id"`
+		Title string `db:"title"`
+	}, 0)
+	if err := s.tx.SelectContext(s.ctx, &rows, `SELECT "id", "title" FROM "roles";`); err != nil {
+		return fmt.Errorf("get roles failed: %v", err)
+	}
+	for _, r := range rows {
+		roles[r.Title] = r.Id
+	}
+
+	query := `
+	INSERT INTO "users" (
+		"username",
+		"email",
+		"password",
+		"role_id"
+	)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT ("email") DO UPDATE SET
+		"username" = EXCLUDED."username",
+		"password" = EXCLUDED."password",
+		"role_id" = EXCLUDED."role_id"
+	RETURNING "id";`
+
+	for _, u := range s.fixture.Users {
+		roleId, ok := roles[u.Role]
+		if !ok {
+			return fmt.Errorf("seed user %s failed: role %q not found", u.Email, u.Role)
+		}
+
+		// Hash exactly like sign up does
+		req := &users.UserRegisterReq{
+			Email:    u.Email,
+			Username: u.Username,
+			Password: u.Password,
+		}
+		if err := req.HashPassword(s.hasher); err != nil {
+			return err
+		}
+
+		var id string
+		if err := s.tx.QueryRowContext(s.ctx, query, req.Username, req.Email, req.Password, roleId).Scan(&id); err != nil {
+			return fmt.Errorf("seed user %s failed: %v", u.Email, err)
+		}
+		s.users[u.Email] = id
+	}
+	return nil
+}
+
+func (s *seeder) seedCategories() error {
+	query := `
+	INSERT INTO "categories" (
+		"title"
+	)
+	VALUES ($1)
+	ON CONFLICT ("title") DO UPDATE SET
+		"title" = EXCLUDED."title"
+	RETURNING "id";`
+
+	for _, title := range s.fixture.Categories {
+		var id int
+		if err := s.tx.QueryRowContext(s.ctx, query, title).Scan(&id); err != nil {
+			return fmt.Errorf("seed category %s failed: %v", title, err)
+		}
+		s.categories[title] = id
+	}
+	return nil
+}
+
+func (s *seeder) seedProducts() error {
+	productQuery := `
+	INSERT INTO "products" (
+		"id",
+		"title",
+		"description",
+		"price"
+	)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT ("id") DO UPDATE SET
+		"title" = EXCLUDED."title",
+		"description" = EXCLUDED."description",
+		"price" = EXCLUDED."price";`
+
+	imageQuery := `
+	INSERT INTO "images" (
+		"id",
+		"filename",
+		"url",
+		"product_id"
+	)
+	VALUES ($1, $2, $3, $4)
+	ON CONFLICT ("id") DO UPDATE SET
+		"filename" = EXCLUDED."filename",
+		"url" = EXCLUDED."url",
+		"product_id" = EXCLUDED."product_id";`
+
+	for _, p := range s.fixture.Products {
+		if _, err := s.tx.ExecContext(s.ctx, productQuery, p.Id, p.Title, p.Description, p.Price); err != nil {
+			return fmt.Errorf("seed product %s failed: %v", p.Id, err)
+		}
+
+		// products_categories has no natural key, replace the rows instead
+		if _, err := s.tx.ExecContext(s.ctx, `DELETE FROM "products_categories" WHERE "product_id" = $1;`, p.Id); err != nil {
+			return fmt.Errorf("seed product %s categories failed: %v", p.Id, err)
+		}
+		if p.Category != "" {
+			categoryId, ok := s.categories[p.Category]
+			if !ok {
+				return fmt.Errorf("seed product %s failed: category %q is not in the fixture", p.Id, p.Category)
+			}
+			if _, err := s.tx.ExecContext(s.ctx, `INSERT INTO "products_categories" ("product_id", "category_id") VALUES ($1, $2);`, p.Id, categoryId); err != nil {
+				return fmt.Errorf("seed product %s categories failed: %v", p.Id, err)
+			}
+		}
+
+		for _, img := range p.Images {
+			if _, err := s.tx.ExecContext(s.ctx, imageQuery, img.Id, img.Filename, img.Url, p.Id); err != nil {
+				return fmt.Errorf("seed image %s failed: %v", img.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// orderProduct is the snapshot of a product stored with an order.
+type orderProduct struct {
+	Id          string          `json:"id"`
+	Title       string          `json:"title"`
+	Price       float64         `json:"price"`
+	Description string          `json:"description"`
+	Category    *orderCategory  `json:"category"`
+	Images      []*FixtureImage `json:"images"`
+}
+
+type orderCategory struct {
+	Id    int    `json:"id"`
+	Title string `json:"title"`
+}
+
+func (s *seeder) seedOrders() error {
+	products := make(map[string]*FixtureProduct)
+	for _, p := range s.fixture.Products {
+		products[p.Id] = p
+	}
+
+	orderQuery := `
+	INSERT INTO "orders" (
+		"id",
+		"user_id",
+		"contact",
+		"address",
+		"transfer_slip",
+		"status"
+	)
+	VALUES ($1, $2, $3, $4, $5, $6)
+	ON CONFLICT ("id") DO UPDATE SET
+		"user_id" = EXCLUDED."user_id",
+		"contact" = EXCLUDED."contact",
+		"address" = EXCLUDED."address",
+		"transfer_slip" = EXCLUDED."transfer_slip",
+		"status" = EXCLUDED."status";`
+
+	for _, o := range s.fixture.Orders {
+		userId, ok := s.users[o.User]
+		if !ok {
+			return fmt.Errorf("seed order %s failed: user %q is not in the fixture", o.Id, o.User)
+		}
+
+		var slip any
+		if o.TransferSlip != nil {
+			data, err := json.Marshal(o.TransferSlip)
+			if err != nil {
+				return fmt.Errorf("seed order %s failed: %v", o.Id, err)
+			}
+			slip = string(data)
+		}
+		if _, err := s.tx.ExecContext(s.ctx, orderQuery, o.Id, userId, o.Contact, o.Address, slip, o.Status); err != nil {
+			return fmt.Errorf("seed order %s failed: %v", o.Id, err)
+		}
+
+		if _, err := s.tx.ExecContext(s.ctx, `DELETE FROM "products_orders" WHERE "order_id" = $1;`, o.Id); err != nil {
+			return fmt.Errorf("seed order %s products failed: %v", o.Id, err)
+		}
+		for _, item := range o.Products {
+			p, ok := products[item.Product]
+			if !ok {
+				return fmt.Errorf("seed order %s failed: product %q is not in the fixture", o.Id, item.Product)
+			}
+			snapshot, err := json.Marshal(&orderProduct{
+				Id:          p.Id,
+				Title:       p.Title,
+				Price:       p.Price,
+				Description: p.Description,
+				Category: &orderCategory{
+					Id:    s.categories[p.Category],
+					Title: p.Category,
+				},
+				Images: p.Images,
+			})
+			if err != nil {
+				return fmt.Errorf("seed order %s failed: %v", o.Id, err)
+			}
+			if _, err := s.tx.ExecContext(s.ctx, `INSERT INTO "products_orders" ("order_id", "qty", "product") VALUES ($1, $2, $3);`, o.Id, item.Qty, string(snapshot)); err != nil {
+				return fmt.Errorf("seed order %s products failed: %v", o.Id, err)
+			}
+		}
+	}
+	return nil
+}
+
+// syncSequences moves the id sequences past the ids written by the fixture,
+// otherwise the next product or order created through the API would collide.
+func (s *seeder) syncSequences() error {
+	tables := []struct {
+		table    string
+		sequence string
+	}{
+		{"products", "products_id_seq"},
+		{"orders", "orders_id_seq"},
+	}
+	for _, t := range tables {
+		query := fmt.Sprintf(`
+		SELECT SETVAL('%s', "t"."max_id")
+		FROM (
+			SELECT MAX(SUBSTRING("id" FROM 2)::INT) AS "max_id" FROM "%s"
+		) AS "t"
+		WHERE "t"."max_id" >= (SELECT "last_value" FROM %s);`, t.sequence, t.table, t.sequence)
+		if _, err := s.tx.ExecContext(s.ctx, query); err != nil {
+			return fmt.Errorf("sync %s failed: %v", t.sequence, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,72 @@
+package databases
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// IQueryer is implemented by both *sqlx.DB and *sqlx.Tx, so a repository can
+// run the same queries inside or outside a transaction.
+type IQueryer interface {
+	sqlx.ExtContext
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	GetContext(ctx context.Context, dest any, query string, args ...any) error
+	SelectContext(ctx context.Context, dest any, query string, args ...any) error
+	NamedExecContext(ctx context.Context, query string, arg any) (sql.Result, error)
+}
+
+var (
+	_ IQueryer = (*sqlx.DB)(nil)
+	_ IQueryer = (*sqlx.Tx)(nil)
+)
+
+// WithTx runs fn inside a transaction. It commits when fn returns nil and
+// rolls back when fn returns an error or panics, the panic is re-raised.
+func WithTx(ctx context.Context, db *sqlx.DB, fn func(tx *sqlx.Tx) error) (err error) {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction failed: %v", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback failed: %v)", err, rbErr)
+		}
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction failed: %v", err)
+	}
+	return nil
+}
+
+// RunInTx is WithTx for code that only holds an IQueryer: it starts a
+// transaction on a *sqlx.DB and joins the running one on a *sqlx.Tx.
+func RunInTx(ctx context.Context, db IQueryer, fn func(tx IQueryer) error) error {
+	switch d := db.(type) {
+	case *sqlx.DB:
+		return WithTx(ctx, d, func(tx *sqlx.Tx) error { return fn(tx) })
+	default:
+		return fn(db)
+	}
+}
+
+// QueryContext bounds ctx by the default per-query deadline, a deadline
+// already on ctx wins when it is sooner. A zero timeout adds no deadline.
+func QueryContext(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -5,7 +5,8 @@ import (
 	"fmt"
 	"github/Panyakorn4/kwanjai-shop-tutorial/config"
 	"github/Panyakorn4/kwanjai-shop-tutorial/modules/users"
-	"math"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/kwanjaimetrics"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -50,18 +51,22 @@ func ParseToken(cfg config.IJwtConfig, tokenString string) (*kwanjaiMapClaims, e
 	})
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return nil, fmt.Errorf("token format is invalid")
+			kwanjaimetrics.TokenRejected("malformed")
+			return nil, apperrors.NewUnauthorized("token format is invalid")
 		} else if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, fmt.Errorf("token had expired")
+			kwanjaimetrics.TokenRejected("expired")
+			return nil, apperrors.NewUnauthorized("token had expired")
 		} else {
-			return nil, fmt.Errorf("parse token failed: %v", err)
+			kwanjaimetrics.TokenRejected("invalid")
+			return nil, apperrors.Wrap(apperrors.Unauthorized, err, "parse token failed")
 		}
 	}
 
 	if claims, ok := token.Claims.(*kwanjaiMapClaims); ok {
 		return claims, nil
 	} else {
-		return nil, fmt.Errorf("claims type is invalid")
+		kwanjaimetrics.TokenRejected("claims")
+		return nil, apperrors.NewUnauthorized("claims type is invalid")
 	}
 }
 func RepeatToken(cfg config.IJwtConfig, claims *users.UserClaims, exp int64) string {
@@ -82,8 +87,8 @@ func RepeatToken(cfg config.IJwtConfig, claims *users.UserClaims, exp int64) str
 	return obj.SignToken()
 }
 
-func jwtTimeDurationCal(t int) *jwt.NumericDate {
-	return jwt.NewNumericDate(time.Now().Add(time.Duration(int64(t) * int64(math.Pow10(9)))))
+func jwtTimeDurationCal(t time.Duration) *jwt.NumericDate {
+	return jwt.NewNumericDate(time.Now().Add(t))
 }
 
 func (a *kwanjaiAuth) SignToken() string {
@@ -157,18 +162,18 @@ func ParseAdminToken(cfg config.IJwtConfig, tokenString string) (*kwanjaiMapClai
 	})
 	if err != nil {
 		if errors.Is(err, jwt.ErrTokenMalformed) {
-			return nil, fmt.Errorf("token format is invalid")
+			return nil, apperrors.NewUnauthorized("token format is invalid")
 		} else if errors.Is(err, jwt.ErrTokenExpired) {
-			return nil, fmt.Errorf("token had expired")
+			return nil, apperrors.NewUnauthorized("token had expired")
 		} else {
-			return nil, fmt.Errorf("parse token failed: %v", err)
+			return nil, apperrors.Wrap(apperrors.Unauthorized, err, "parse token failed")
 		}
 	}
 
 	if claims, ok := token.Claims.(*kwanjaiMapClaims); ok {
 		return claims, nil
 	} else {
-		return nil, fmt.Errorf("claims type is invalid")
+		return nil, apperrors.NewUnauthorized("claims type is invalid")
 	}
 }
 
@@ -182,7 +187,7 @@ func newAdminToken(cfg config.IJwtConfig) IKwanjaiAuth {
 					Issuer:    "kwanjai-api",
 					Subject:   "admin-token",
 					Audience:  []string{"admin"},
-					ExpiresAt: jwtTimeDurationCal(300),
+					ExpiresAt: jwtTimeDurationCal(5 * time.Minute),
 					NotBefore: jwt.NewNumericDate(time.Now()),
 					IssuedAt:  jwt.NewNumericDate(time.Now()),
 				},
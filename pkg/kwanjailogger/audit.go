@@ -0,0 +1,215 @@
+package kwanjailogger
+
+import (
+	"context"
+	"errors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var (
+	ErrAuditClosed  = errors.New("audit log is closed")
+	ErrAuditDropped = errors.New("audit log is full, entry dropped")
+)
+
+type IAuditWriter interface {
+	// Write queues one entry, it only blocks when the queue is full and the
+	// overflow policy is block.
+	Write(entry []byte) error
+	// Flush waits until every queued entry is on disk.
+	Flush(ctx context.Context) error
+	// Close flushes and stops the writer, later writes fail with ErrAuditClosed.
+	Close(ctx context.Context) error
+	// Dropped is the number of entries lost to the overflow policy.
+	Dropped() int64
+}
+
+type auditWriter struct {
+	out           *rotatingFile
+	overflow      string
+	flushInterval time.Duration
+	logger        *slog.Logger
+
+	mu      sync.RWMutex // guards closed against sends on entries
+	closed  bool
+	entries chan []byte
+	flushes chan chan error
+	done    chan struct{}
+	dropped atomic.Int64
+}
+
+// AuditWriter starts the writer goroutine of the audit log described by cfg.
+func AuditWriter(cfg config.IAuditConfig, logger *slog.Logger) IAuditWriter {
+	w := &auditWriter{
+		out: &rotatingFile{
+			dir:      cfg.Dir(),
+			prefix:   "kwanjailogger_",
+			ext:      ".txt",
+			maxSize:  int64(cfg.MaxSize()),
+			maxAge:   cfg.MaxAge(),
+			maxFiles: cfg.MaxFiles(),
+			compress: cfg.Compress(),
+			now:      time.Now,
+		},
+		overflow:      cfg.Overflow(),
+		flushInterval: cfg.FlushInterval(),
+		logger:        For(logger, "audit"),
+		entries:       make(chan []byte, cfg.Buffer()),
+		flushes:       make(chan chan error),
+		done:          make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *auditWriter) Write(entry []byte) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+	if w.closed {
+		return ErrAuditClosed
+	}
+
+	switch w.overflow {
+	case "drop_new":
+		select {
+		case w.entries <- entry:
+			return nil
+		default:
+			w.dropped.Add(1)
+			return ErrAuditDropped
+		}
+	case "drop_old":
+		for {
+			select {
+			case w.entries <- entry:
+				return nil
+			default:
+			}
+			// Make room by dropping the oldest entry, unless the writer got to it first
+			select {
+			case <-w.entries:
+				w.dropped.Add(1)
+			default:
+			}
+		}
+	default:
+		w.entries <- entry
+		return nil
+	}
+}
+
+func (w *auditWriter) Flush(ctx context.Context) error {
+	w.mu.RLock()
+	if w.closed {
+		w.mu.RUnlock()
+		return ErrAuditClosed
+	}
+	res := make(chan error, 1)
+	select {
+	case w.flushes <- res:
+	case <-ctx.Done():
+		w.mu.RUnlock()
+		return ctx.Err()
+	}
+	w.mu.RUnlock()
+
+	select {
+	case err := <-res:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *auditWriter) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.entries)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *auditWriter) Dropped() int64 {
+	return w.dropped.Load()
+}
+
+func (w *auditWriter) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.flushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case entry, ok := <-w.entries:
+			if !ok {
+				w.report(w.out.Close())
+				return
+			}
+			w.report(w.out.WriteLine(entry))
+		case res := <-w.flushes:
+			w.drain()
+			res <- w.out.Flush()
+		case <-ticker.C:
+			w.report(w.out.Flush())
+		}
+	}
+}
+
+// drain writes what is already queued, entries queued meanwhile wait for
+// the next round.
+func (w *auditWriter) drain() {
+	for n := len(w.entries); n > 0; n-- {
+		entry, ok := <-w.entries
+		if !ok {
+			return
+		}
+		w.report(w.out.WriteLine(entry))
+	}
+}
+
+// report logs a write failure, the entry is lost but the server keeps going.
+func (w *auditWriter) report(err error) {
+	if err != nil {
+		w.logger.Error("write audit log failed", "error", err)
+	}
+}
+
+// discard is the audit writer until SetAudit is called, and when the audit
+// log is disabled.
+type discard struct{}
+
+func (discard) Write([]byte) error          { return nil }
+func (discard) Flush(context.Context) error { return nil }
+func (discard) Close(context.Context) error { return nil }
+func (discard) Dropped() int64              { return 0 }
+
+// Discard returns an audit writer that throws every entry away.
+func Discard() IAuditWriter {
+	return discard{}
+}
+
+var audit atomic.Pointer[IAuditWriter]
+
+func init() {
+	SetAudit(Discard())
+}
+
+// SetAudit makes w the writer Save sends access records to.
+func SetAudit(w IAuditWriter) {
+	audit.Store(&w)
+}
+
+func auditLog() IAuditWriter {
+	return *audit.Load()
+}
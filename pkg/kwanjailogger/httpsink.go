@@ -0,0 +1,127 @@
+package kwanjailogger
+
+import (
+	"bytes"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"net/http"
+	"time"
+)
+
+const (
+	httpRetryBackoff = 500 * time.Millisecond
+	// httpQueueBatches is how many batches may wait for the collector before
+	// new records are dropped.
+	httpQueueBatches = 10
+)
+
+// httpLog posts the records in batches as a JSON array. A batch is sent once
+// it is full or flushInterval after its first record, and retried with a
+// growing backoff when the collector fails or answers 429 or 5xx. Any other
+// status outside 2xx drops the batch at once, sending it again will not help.
+type httpLog struct {
+	*queue
+	url           string
+	token         string
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+	client        *http.Client
+}
+
+func httpSink(cfg config.ILogHttpConfig) *httpLog {
+	h := &httpLog{
+		queue:         newQueue("http", cfg.BatchSize()*httpQueueBatches),
+		url:           cfg.Url(),
+		token:         cfg.Token(),
+		batchSize:     cfg.BatchSize(),
+		flushInterval: cfg.FlushInterval(),
+		retries:       cfg.Retries(),
+		client:        &http.Client{Timeout: cfg.Timeout()},
+	}
+	go h.run()
+	return h
+}
+
+func (h *httpLog) run() {
+	defer close(h.done)
+	batch := make([][]byte, 0, h.batchSize)
+	timer := time.NewTimer(h.flushInterval)
+	timer.Stop()
+	defer timer.Stop()
+
+	send := func() {
+		if len(batch) > 0 {
+			h.send(batch)
+			batch = batch[:0]
+		}
+		timer.Stop()
+	}
+	for {
+		select {
+		case record, ok := <-h.records:
+			if !ok {
+				send()
+				return
+			}
+			if len(batch) == 0 {
+				timer.Reset(h.flushInterval)
+			}
+			batch = append(batch, record)
+			if len(batch) >= h.batchSize {
+				send()
+			}
+		case <-timer.C:
+			send()
+		}
+	}
+}
+
+func (h *httpLog) send(batch [][]byte) {
+	body := make([]byte, 0, 2+len(batch)*256)
+	body = append(body, '[')
+	body = append(body, bytes.Join(batch, []byte(","))...)
+	body = append(body, ']')
+
+	backoff := httpRetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := h.post(body)
+		if err == nil {
+			return
+		}
+		if !retry || attempt >= h.retries {
+			h.fail(len(batch), err)
+			return
+		}
+		select {
+		case <-time.After(backoff):
+			backoff *= 2
+		case <-h.abort.Done():
+			h.fail(len(batch), err)
+			return
+		}
+	}
+}
+
+// post sends body once. retry reports whether a failure may go away when
+// the same batch is sent again.
+func (h *httpLog) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(h.abort, http.MethodPost, h.url, bytes.NewReader(body))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if h.token != "" {
+		req.Header.Set("Authorization", "Bearer "+h.token)
+	}
+	res, err := h.client.Do(req)
+	if err != nil {
+		return true, err
+	}
+	res.Body.Close()
+	if res.StatusCode >= 200 && res.StatusCode < 300 {
+		return false, nil
+	}
+	err = fmt.Errorf("collector answered %d", res.StatusCode)
+	return res.StatusCode == http.StatusTooManyRequests || res.StatusCode >= 500, err
+}
@@ -0,0 +1,215 @@
+package kwanjailogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type testHttpConfig struct {
+	url           string
+	batchSize     int
+	flushInterval time.Duration
+	retries       int
+}
+
+func (c *testHttpConfig) Enabled() bool                { return true }
+func (c *testHttpConfig) Level() string                { return "debug" }
+func (c *testHttpConfig) Url() string                  { return c.url }
+func (c *testHttpConfig) Token() string                { return "secret" }
+func (c *testHttpConfig) BatchSize() int               { return c.batchSize }
+func (c *testHttpConfig) FlushInterval() time.Duration { return c.flushInterval }
+func (c *testHttpConfig) Retries() int                 { return c.retries }
+func (c *testHttpConfig) Timeout() time.Duration       { return 5 * time.Second }
+
+// collector records the batches it receives and answers with the statuses
+// in order, then 200.
+type collector struct {
+	mu       sync.Mutex
+	batches  [][]string
+	statuses []int
+	auth     string
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var batch []map[string]any
+	body, _ := io.ReadAll(r.Body)
+	if err := json.Unmarshal(body, &batch); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.auth = r.Header.Get("Authorization")
+	msgs := make([]string, 0, len(batch))
+	for _, record := range batch {
+		msgs = append(msgs, fmt.Sprint(record["msg"]))
+	}
+	c.batches = append(c.batches, msgs)
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+		w.WriteHeader(status)
+	}
+}
+
+func (c *collector) received() [][]string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([][]string(nil), c.batches...)
+}
+
+func writeRecords(t *testing.T, w io.Writer, msgs ...string) {
+	t.Helper()
+	for _, msg := range msgs {
+		if _, err := fmt.Fprintf(w, `{"level":"INFO","msg":%q}`+"\n", msg); err != nil {
+			t.Fatalf("write %s: %v", msg, err)
+		}
+	}
+}
+
+func closeWithin(t *testing.T, closer func(context.Context) error, timeout time.Duration) error {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return closer(ctx)
+}
+
+func TestHttpSinkBatches(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h := httpSink(&testHttpConfig{url: srv.URL, batchSize: 3, flushInterval: time.Hour})
+	writeRecords(t, h, "1", "2", "3", "4", "5", "6", "7")
+	if err := closeWithin(t, h.Close, 5*time.Second); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	got := fmt.Sprint(c.received())
+	if want := "[[1 2 3] [4 5 6] [7]]"; got != want {
+		t.Errorf("batches = %s, want %s", got, want)
+	}
+	if c.auth != "Bearer secret" {
+		t.Errorf("authorization = %q, want the bearer token", c.auth)
+	}
+}
+
+func TestHttpSinkFlushesAfterInterval(t *testing.T) {
+	c := new(collector)
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h := httpSink(&testHttpConfig{url: srv.URL, batchSize: 100, flushInterval: 50 * time.Millisecond})
+	defer closeWithin(t, h.Close, 5*time.Second)
+	writeRecords(t, h, "1", "2")
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(c.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("batch was not sent after the flush interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got, want := fmt.Sprint(c.received()), "[[1 2]]"; got != want {
+		t.Errorf("batches = %s, want %s", got, want)
+	}
+}
+
+func TestHttpSinkRetries(t *testing.T) {
+	c := &collector{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h := httpSink(&testHttpConfig{url: srv.URL, batchSize: 1, flushInterval: time.Hour, retries: 2})
+	writeRecords(t, h, "1")
+	if err := closeWithin(t, h.Close, 10*time.Second); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if got, want := fmt.Sprint(c.received()), "[[1] [1] [1]]"; got != want {
+		t.Errorf("batches = %s, want %s", got, want)
+	}
+}
+
+func TestHttpSinkDropsAfterRetries(t *testing.T) {
+	c := &collector{statuses: []int{http.StatusInternalServerError, http.StatusInternalServerError}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h := httpSink(&testHttpConfig{url: srv.URL, batchSize: 1, flushInterval: time.Hour, retries: 1})
+	writeRecords(t, h, "1")
+	err := closeWithin(t, h.Close, 10*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 record(s)") {
+		t.Errorf("close = %v, want the dropped record reported", err)
+	}
+	if n := len(c.received()); n != 2 {
+		t.Errorf("got %d attempts, want 2", n)
+	}
+}
+
+func TestHttpSinkQueueOverflow(t *testing.T) {
+	posted := make(chan struct{}, 1)
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case posted <- struct{}{}:
+		default:
+		}
+		<-release
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	h := httpSink(&testHttpConfig{url: srv.URL, batchSize: 1, flushInterval: time.Hour})
+	// The first record is taken by the writer, which then hangs on the post
+	writeRecords(t, h, "first")
+	<-posted
+
+	for i := 0; i < httpQueueBatches; i++ {
+		writeRecords(t, h, fmt.Sprint(i))
+	}
+	if _, err := h.Write([]byte(`{"msg":"overflow"}` + "\n")); err == nil {
+		t.Fatal("write to a full queue succeeded, want it dropped")
+	}
+
+	// A collector that never answers must not hold Close past its deadline
+	start := time.Now()
+	err := closeWithin(t, h.Close, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "close http log sink failed") {
+		t.Errorf("close = %v, want a timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("close took %s after its deadline", elapsed)
+	}
+	if _, err := h.Write([]byte(`{"msg":"late"}` + "\n")); err == nil {
+		t.Error("write after close succeeded")
+	}
+}
+
+func TestHttpSinkDropsOnClientError(t *testing.T) {
+	c := &collector{statuses: []int{http.StatusUnauthorized}}
+	srv := httptest.NewServer(c)
+	defer srv.Close()
+
+	h := httpSink(&testHttpConfig{url: srv.URL, batchSize: 1, flushInterval: time.Hour, retries: 3})
+	var stderr strings.Builder
+	h.stderr = &stderr
+	writeRecords(t, h, "1")
+	err := closeWithin(t, h.Close, 10*time.Second)
+	if err == nil || !strings.Contains(err.Error(), "dropped 1 record(s)") || !strings.Contains(err.Error(), "401") {
+		t.Errorf("close = %v, want the dropped record and the status reported", err)
+	}
+	if n := len(c.received()); n != 1 {
+		t.Errorf("got %d attempts, want a client error not to be retried", n)
+	}
+	if !strings.Contains(stderr.String(), "collector answered 401") {
+		t.Errorf("stderr = %q, want the rejected batch reported", stderr.String())
+	}
+}
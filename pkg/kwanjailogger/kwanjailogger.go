@@ -1,11 +1,10 @@
 package kwanjailogger
 
 import (
-	"fmt"
+	"context"
+	"errors"
 	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/utils"
-	"log"
-	"os"
-	"strings"
+	"log/slog"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
@@ -15,74 +14,85 @@ type IKwanjaiLogger interface {
 	Print() IKwanjaiLogger
 	Save()
 	SetQuery(c *fiber.Ctx)
+	SetHeaders(c *fiber.Ctx)
 	SetBody(c *fiber.Ctx)
 	SetResponse(res any)
 }
 
 type kwanjaiLogger struct {
 	Time       string `json:"time"`
+	RequestId  string `json:"request_id"`
 	Ip         string `json:"ip"`
 	Method     string `json:"method"`
 	StatusCode int    `json:"status_code"`
 	Path       string `json:"path"`
 	Query      any    `json:"query"`
+	Headers    any    `json:"headers"`
 	Body       any    `json:"body"`
 	Response   any    `json:"response"`
+
+	ctx context.Context
 }
 
 func InitKwanjaiLogger(c *fiber.Ctx, res any, code int) IKwanjaiLogger {
 	log := &kwanjaiLogger{
 		Time:       time.Now().Local().Format("2006-01-02 15:04:05"),
+		RequestId:  utils.RequestId(c),
 		Ip:         c.IP(),
 		Method:     c.Method(),
 		Path:       c.Path(),
 		StatusCode: code,
+		ctx:        c.UserContext(),
 	}
 	log.SetQuery(c)
+	log.SetHeaders(c)
 	log.SetBody(c)
 	log.SetResponse(res)
 	return log
 }
 
+// Print writes the access record through the default logger under the
+// "access" package, at info level.
 func (l *kwanjaiLogger) Print() IKwanjaiLogger {
-	utils.Debug(l)
+	For(slog.Default(), "access").LogAttrs(l.ctx, slog.LevelInfo, "request",
+		slog.String("ip", l.Ip),
+		slog.Int("status_code", l.StatusCode),
+		slog.Any("query", l.Query),
+		slog.Any("headers", l.Headers),
+		slog.Any("body", l.Body),
+		slog.Any("response", l.Response),
+	)
 	return l
 }
 
+// Save queues the access record for the audit log, see SetAudit.
 func (l *kwanjaiLogger) Save() {
-	data := utils.Output(l)
-
-	filename := fmt.Sprintf("./assets/logs/kwanjailogger_%v.txt", strings.ReplaceAll(time.Now().Format("2006-01-02"), "-", ""))
-	file, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0666)
-	if err != nil {
-		log.Fatalf("error opening file: %v", err)
+	if err := auditLog().Write(utils.Output(l)); err != nil && !errors.Is(err, ErrAuditDropped) {
+		For(slog.Default(), "audit").WarnContext(l.ctx, "save access record failed", "error", err)
 	}
-	defer file.Close()
-	file.WriteString(string(data) + "\n")
 }
 
+// The Set methods keep a redacted copy only, secrets never reach a sink.
 func (l *kwanjaiLogger) SetQuery(c *fiber.Ctx) {
-	var body any
-	if err := c.QueryParser(&body); err != nil {
-		log.Printf("query parser error: %v", err)
-	}
-	l.Query = body
+	l.Query = Redact(c.Queries())
+}
+
+func (l *kwanjaiLogger) SetHeaders(c *fiber.Ctx) {
+	l.Headers = RedactHeaders(c.GetReqHeaders())
 }
 
 func (l *kwanjaiLogger) SetBody(c *fiber.Ctx) {
+	if len(c.Body()) == 0 {
+		return
+	}
 	var body any
 	if err := c.BodyParser(&body); err != nil {
-		log.Printf("body parser error: %v", err)
-	}
-
-	switch l.Path {
-	case "v1/users/signup":
-		l.Body = "never gonna give you up"
-	default:
-		l.Body = body
+		For(slog.Default(), "access").DebugContext(c.UserContext(), "body parser error", "error", err)
+		return
 	}
+	l.Body = Redact(body)
 }
 
 func (l *kwanjaiLogger) SetResponse(res any) {
-	l.Response = res
+	l.Response = Redact(res)
 }
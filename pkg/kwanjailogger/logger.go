@@ -0,0 +1,151 @@
+package kwanjailogger
+
+import (
+	"context"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"io"
+	"log/slog"
+	"sync/atomic"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+// PackageKey is the attribute For sets, the handler picks the level of the
+// logger from it.
+const PackageKey = "package"
+
+// levelSet is the default level and the per-package overrides, every logger
+// built by New shares the current one so a config reload applies at once.
+type levelSet struct {
+	level    slog.Level
+	packages map[string]slog.Level
+}
+
+func (s *levelSet) of(pkg string) slog.Level {
+	if l, ok := s.packages[pkg]; ok {
+		return l
+	}
+	return s.level
+}
+
+var levels atomic.Pointer[levelSet]
+
+func init() {
+	levels.Store(&levelSet{level: slog.LevelInfo})
+}
+
+// SetLevels applies the level and the per-package levels of cfg.
+func SetLevels(cfg config.ILogConfig) error {
+	set := &levelSet{
+		packages: make(map[string]slog.Level),
+	}
+	if err := set.level.UnmarshalText([]byte(cfg.Level())); err != nil {
+		return err
+	}
+	for pkg, l := range cfg.PackageLevels() {
+		var level slog.Level
+		if err := level.UnmarshalText([]byte(l)); err != nil {
+			return err
+		}
+		set.packages[pkg] = level
+	}
+	levels.Store(set)
+	return nil
+}
+
+// Reload applies the levels and the redaction rules of cfg.
+func Reload(cfg config.ILogConfig) error {
+	SetRedaction(cfg)
+	return SetLevels(cfg)
+}
+
+// New builds a logger writing JSON or text to w only, for the commands that
+// do not serve. Records logged with a context carrying Fields get the
+// request fields added, and with a context carrying a span its trace id.
+func New(cfg config.ILogConfig, w io.Writer) *slog.Logger {
+	if err := Reload(cfg); err != nil {
+		slog.Warn("set log levels failed", "error", err)
+	}
+	return slog.New(&handler{inner: formatHandler(cfg.Format(), w)})
+}
+
+// For returns l for the named package, whose level can be set on its own.
+func For(l *slog.Logger, pkg string) *slog.Logger {
+	return l.With(slog.String(PackageKey, pkg))
+}
+
+// Fields are the request scoped values added to every record logged with the
+// request's context. They are filled in as the request goes through the
+// middlewares, so they are kept behind a pointer.
+type Fields struct {
+	RequestId string
+	UserId    string
+	Method    string
+	Route     string
+}
+
+type fieldsKey struct{}
+
+func WithFields(ctx context.Context, f *Fields) context.Context {
+	return context.WithValue(ctx, fieldsKey{}, f)
+}
+
+// FieldsFrom returns the fields of ctx, nil when there are none.
+func FieldsFrom(ctx context.Context) *Fields {
+	f, _ := ctx.Value(fieldsKey{}).(*Fields)
+	return f
+}
+
+type handler struct {
+	inner slog.Handler
+	pkg   string
+}
+
+func (h *handler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= levels.Load().of(h.pkg)
+}
+
+func (h *handler) Handle(ctx context.Context, r slog.Record) error {
+	r = r.Clone()
+	if h.pkg != "" {
+		r.AddAttrs(slog.String(PackageKey, h.pkg))
+	}
+	if f := FieldsFrom(ctx); f != nil {
+		r.AddAttrs(slog.String("request_id", f.RequestId))
+		if f.UserId != "" {
+			r.AddAttrs(slog.String("user_id", f.UserId))
+		}
+		if f.Route != "" {
+			r.AddAttrs(slog.String("method", f.Method), slog.String("route", f.Route))
+		}
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()), slog.String("span_id", sc.SpanID().String()))
+	}
+	return h.inner.Handle(ctx, r)
+}
+
+// WithAttrs keeps the package out of the inner handler, so For on a package
+// logger replaces the package instead of adding a second one.
+func (h *handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := &handler{
+		pkg: h.pkg,
+	}
+	rest := make([]slog.Attr, 0, len(attrs))
+	for _, a := range attrs {
+		if a.Key == PackageKey {
+			next.pkg = a.Value.String()
+			continue
+		}
+		rest = append(rest, a)
+	}
+	next.inner = h.inner.WithAttrs(rest)
+	return next
+}
+
+func (h *handler) WithGroup(name string) slog.Handler {
+	return &handler{
+		inner: h.inner.WithGroup(name),
+		pkg:   h.pkg,
+	}
+}
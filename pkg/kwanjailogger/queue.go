@@ -0,0 +1,101 @@
+package kwanjailogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// queue hands the records of a network sink to its writer goroutine, so
+// logging never blocks on the network. A record that does not fit is dropped.
+// The writer closes done once records is closed and drained.
+type queue struct {
+	name    string
+	mu      sync.RWMutex // guards closed against sends on records
+	closed  bool
+	records chan []byte
+	// abort is done once Close gave up waiting, the writer then drops what
+	// is left and cancels the call in flight
+	abort   context.Context
+	cancel  context.CancelFunc
+	done    chan struct{}
+	dropped atomic.Int64
+
+	failMu  sync.Mutex
+	lastErr error
+	stderr  io.Writer
+}
+
+func newQueue(name string, size int) *queue {
+	abort, cancel := context.WithCancel(context.Background())
+	return &queue{
+		name:    name,
+		records: make(chan []byte, size),
+		abort:   abort,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		stderr:  os.Stderr,
+	}
+}
+
+// fail counts n records the writer dropped because of err. The sink cannot
+// log through itself, so err goes to stderr, once until a different one.
+func (q *queue) fail(n int, err error) {
+	q.dropped.Add(int64(n))
+	q.failMu.Lock()
+	defer q.failMu.Unlock()
+	if q.lastErr == nil || q.lastErr.Error() != err.Error() {
+		fmt.Fprintf(q.stderr, "%s log sink dropped %d record(s): %v\n", q.name, n, err)
+	}
+	q.lastErr = err
+}
+
+func (q *queue) Write(p []byte) (int, error) {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	if q.closed {
+		return 0, fmt.Errorf("%s log sink is closed", q.name)
+	}
+	// slog reuses p once Write returns
+	record := bytes.TrimRight(append([]byte(nil), p...), "\n")
+	select {
+	case q.records <- record:
+		return len(p), nil
+	default:
+		q.dropped.Add(1)
+		return 0, fmt.Errorf("%s log sink is full, record dropped", q.name)
+	}
+}
+
+// Close waits for the writer to send what is queued, aborting it when ctx
+// is done.
+func (q *queue) Close(ctx context.Context) error {
+	q.mu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.records)
+	}
+	q.mu.Unlock()
+
+	defer q.cancel()
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		q.cancel()
+		<-q.done
+		return fmt.Errorf("close %s log sink failed: %v", q.name, ctx.Err())
+	}
+	if n := q.dropped.Load(); n > 0 {
+		q.failMu.Lock()
+		defer q.failMu.Unlock()
+		if q.lastErr != nil {
+			return fmt.Errorf("%s log sink dropped %d record(s), last error: %v", q.name, n, q.lastErr)
+		}
+		return fmt.Errorf("%s log sink dropped %d record(s)", q.name, n)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package kwanjailogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"path"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+const redacted = "[REDACTED]"
+
+// rule matches a field either by its name anywhere in the document, or by
+// its full path when the pattern starts with $. Array indexes are not part
+// of a path, $.orders[*].email and $.orders.email are the same rule.
+type rule struct {
+	name string
+	path []string
+}
+
+func newRule(pattern string) *rule {
+	pattern = strings.ToLower(pattern)
+	if rest, ok := strings.CutPrefix(pattern, "$."); ok {
+		return &rule{path: strings.Split(strings.ReplaceAll(rest, "[*]", ""), ".")}
+	}
+	return &rule{name: pattern}
+}
+
+func (r *rule) match(fieldPath []string) bool {
+	if r.path == nil {
+		ok, _ := path.Match(r.name, fieldPath[len(fieldPath)-1])
+		return ok
+	}
+	if len(r.path) != len(fieldPath) {
+		return false
+	}
+	for i, segment := range r.path {
+		if ok, _ := path.Match(segment, fieldPath[i]); !ok {
+			return false
+		}
+	}
+	return true
+}
+
+type redactor struct {
+	full    []*rule
+	partial []*rule
+	headers map[string]bool // lower case names
+}
+
+var redaction atomic.Pointer[redactor]
+
+func init() {
+	redaction.Store(&redactor{headers: make(map[string]bool)})
+}
+
+// SetRedaction applies the redaction rules of cfg.
+func SetRedaction(cfg config.ILogConfig) {
+	r := &redactor{
+		headers: make(map[string]bool),
+	}
+	for _, p := range cfg.RedactFields() {
+		r.full = append(r.full, newRule(p))
+	}
+	for _, p := range cfg.RedactPartial() {
+		r.partial = append(r.partial, newRule(p))
+	}
+	for _, h := range cfg.RedactHeaders() {
+		r.headers[strings.ToLower(h)] = true
+	}
+	redaction.Store(r)
+}
+
+// Redact returns a copy of v with the configured fields masked. v goes
+// through JSON first, so struct fields are matched by their json names and
+// v itself is never modified.
+func Redact(v any) any {
+	if v == nil {
+		return nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return redacted
+	}
+	var generic any
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return redacted
+	}
+	return redaction.Load().walk(generic, nil)
+}
+
+// RedactHeaders flattens headers and masks the configured ones.
+func RedactHeaders(headers map[string][]string) map[string]string {
+	r := redaction.Load()
+	out := make(map[string]string, len(headers))
+	for k, v := range headers {
+		if r.headers[strings.ToLower(k)] {
+			out[k] = redacted
+			continue
+		}
+		out[k] = strings.Join(v, ", ")
+	}
+	return out
+}
+
+func (r *redactor) walk(v any, fieldPath []string) any {
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			p := append(fieldPath[:len(fieldPath):len(fieldPath)], strings.ToLower(k))
+			switch {
+			case matchAny(r.full, p):
+				t[k] = redacted
+			case matchAny(r.partial, p):
+				t[k] = mask(child)
+			default:
+				t[k] = r.walk(child, p)
+			}
+		}
+	case []any:
+		for i := range t {
+			t[i] = r.walk(t[i], fieldPath)
+		}
+	}
+	return v
+}
+
+func matchAny(rules []*rule, fieldPath []string) bool {
+	for _, r := range rules {
+		if r.match(fieldPath) {
+			return true
+		}
+	}
+	return false
+}
+
+// mask keeps enough of a value to tell records apart, the first letter and
+// the domain of an email, the first two letters of anything else.
+func mask(v any) any {
+	s, ok := v.(string)
+	if !ok {
+		return redacted
+	}
+	if local, domain, ok := strings.Cut(s, "@"); ok && local != "" {
+		_, size := utf8.DecodeRuneInString(local)
+		return local[:size] + "***@" + domain
+	}
+	if utf8.RuneCountInString(s) <= 4 {
+		return "***"
+	}
+	_, first := utf8.DecodeRuneInString(s)
+	_, second := utf8.DecodeRuneInString(s[first:])
+	return s[:first+second] + "***"
+}
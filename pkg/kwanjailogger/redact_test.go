@@ -0,0 +1,209 @@
+package kwanjailogger
+
+import (
+	"encoding/json"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// testLogConfig carries the redaction settings only, the sinks are not
+// read by SetRedaction.
+type testLogConfig struct {
+	config.ILogConfig
+	fields  []string
+	partial []string
+	headers []string
+}
+
+func (c *testLogConfig) RedactFields() []string  { return c.fields }
+func (c *testLogConfig) RedactPartial() []string { return c.partial }
+func (c *testLogConfig) RedactHeaders() []string { return c.headers }
+
+// setRedaction applies cfg, or the LOG_REDACT_* defaults when it is nil,
+// until the test ends.
+func setRedaction(t *testing.T, cfg *testLogConfig) {
+	t.Helper()
+	if cfg == nil {
+		cfg = &testLogConfig{
+			fields:  []string{"password", "token", "*_token", "*_key", "secret"},
+			partial: []string{"email"},
+			headers: []string{"Authorization", "X-Api-Key", "Cookie", "Set-Cookie"},
+		}
+	}
+	prev := redaction.Load()
+	t.Cleanup(func() { redaction.Store(prev) })
+	SetRedaction(cfg)
+}
+
+// redactJson redacts the JSON document in and returns it encoded again.
+func redactJson(t *testing.T, in string) string {
+	t.Helper()
+	var v any
+	if err := json.Unmarshal([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	out, err := json.Marshal(Redact(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func TestRedactByName(t *testing.T) {
+	setRedaction(t, nil)
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{
+			name: "exact name",
+			in:   `{"username":"kwanjai","password":"123456"}`,
+			want: `{"password":"[REDACTED]","username":"kwanjai"}`,
+		},
+		{
+			name: "glob",
+			in:   `{"access_token":"a","refresh_token":"b","token_type":"bearer"}`,
+			want: `{"access_token":"[REDACTED]","refresh_token":"[REDACTED]","token_type":"bearer"}`,
+		},
+		{
+			name: "any depth and case",
+			in:   `{"user":{"Password":"x"},"token":{"Access_Token":"y"}}`,
+			want: `{"token":"[REDACTED]","user":{"Password":"[REDACTED]"}}`,
+		},
+		{
+			name: "inside arrays",
+			in:   `{"users":[{"api_key":"k","id":"U000001"}]}`,
+			want: `{"users":[{"api_key":"[REDACTED]","id":"U000001"}]}`,
+		},
+		{
+			name: "objects are masked whole",
+			in:   `{"secret":{"nested":"x"}}`,
+			want: `{"secret":"[REDACTED]"}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := redactJson(t, tt.in); got != tt.want {
+				t.Errorf("got %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedactByPath(t *testing.T) {
+	setRedaction(t, &testLogConfig{
+		fields:  []string{"$.user.id", "$.orders[*].address"},
+		partial: []string{"$.user.email"},
+	})
+	got := redactJson(t, `{
+		"id": "keep",
+		"user": {"id": "U000001", "email": "customer001@kawaii.com"},
+		"email": "kept@kawaii.com",
+		"orders": [{"address": "Navarre, Ohio", "id": "O000001"}],
+		"address": "kept"
+	}`)
+	want := `{"address":"kept","email":"kept@kawaii.com","id":"keep","orders":[{"address":"[REDACTED]","id":"O000001"}],"user":{"email":"c***@kawaii.com","id":"[REDACTED]"}}`
+	if got != want {
+		t.Errorf("got %s\nwant %s", got, want)
+	}
+}
+
+func TestRedactPartial(t *testing.T) {
+	setRedaction(t, &testLogConfig{partial: []string{"email", "name", "phone"}})
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{`{"email":"customer001@kawaii.com"}`, `{"email":"c***@kawaii.com"}`},
+		{`{"email":"ก@kawaii.com"}`, `{"email":"ก***@kawaii.com"}`},
+		{`{"email":"@kawaii.com"}`, `{"email":"@k***"}`},
+		{`{"name":"kwanjai"}`, `{"name":"kw***"}`},
+		{`{"name":"abc"}`, `{"name":"***"}`},
+		{`{"phone":12345678}`, `{"phone":"[REDACTED]"}`},
+	}
+	for _, tt := range tests {
+		if got := redactJson(t, tt.in); got != tt.want {
+			t.Errorf("%s: got %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRedactLeavesInputAlone(t *testing.T) {
+	setRedaction(t, nil)
+	type signIn struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+	}
+	in := &signIn{Email: "customer001@kawaii.com", Password: "123456"}
+	out, _ := json.Marshal(Redact(in))
+	if want := `{"email":"c***@kawaii.com","password":"[REDACTED]"}`; string(out) != want {
+		t.Errorf("got %s, want %s", out, want)
+	}
+	if in.Password != "123456" || in.Email != "customer001@kawaii.com" {
+		t.Errorf("input changed to %+v", in)
+	}
+}
+
+func TestRedactHeaders(t *testing.T) {
+	setRedaction(t, nil)
+	got := RedactHeaders(map[string][]string{
+		"Authorization": {"Bearer eyJ"},
+		"x-api-key":     {"key"},
+		"Accept":        {"application/json", "text/plain"},
+	})
+	want := map[string]string{
+		"Authorization": redacted,
+		"x-api-key":     redacted,
+		"Accept":        "application/json, text/plain",
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+// The access log once masked the body only for the path "v1/users/signup",
+// which c.Path() never returns, so passwords were written in the clear.
+func TestAccessLogRedactsSignUp(t *testing.T) {
+	setRedaction(t, nil)
+	var got *kwanjaiLogger
+	app := fiber.New()
+	app.Post("/v1/users/signup", func(c *fiber.Ctx) error {
+		res := map[string]any{
+			"user":  map[string]any{"id": "U000001", "email": "customer001@kawaii.com"},
+			"token": map[string]any{"access_token": "eyJ", "refresh_token": "eyK"},
+		}
+		got = InitKwanjaiLogger(c, res, fiber.StatusCreated).(*kwanjaiLogger)
+		return c.SendStatus(fiber.StatusCreated)
+	})
+
+	req := httptest.NewRequest(fiber.MethodPost, "/v1/users/signup",
+		strings.NewReader(`{"email":"customer001@kawaii.com","password":"123456","username":"customer001"}`))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	req.Header.Set(fiber.HeaderAuthorization, "Bearer eyJ")
+	if _, err := app.Test(req); err != nil {
+		t.Fatal(err)
+	}
+	if got == nil {
+		t.Fatal("handler did not run")
+	}
+
+	record, err := json.Marshal(got)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"123456", "eyJ", "eyK", "customer001@kawaii.com"} {
+		if strings.Contains(string(record), secret) {
+			t.Errorf("access record %s contains %q", record, secret)
+		}
+	}
+	if got.Path != "/v1/users/signup" {
+		t.Errorf("path = %q, want the leading slash", got.Path)
+	}
+}
@@ -0,0 +1,243 @@
+package kwanjailogger
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rotatingFile appends lines to <dir>/<prefix><yyyymmdd><ext>. The file
+// is rotated on a new day or once it reaches maxSize, rotated files are
+// gzipped and pruned by age and count. The files a previous process left
+// are compressed and pruned once the first file is opened. It is not safe
+// for concurrent use, the audit writer owns it from a single goroutine.
+type rotatingFile struct {
+	dir      string
+	prefix   string
+	ext      string
+	maxSize  int64
+	maxAge   time.Duration
+	maxFiles int
+	compress bool
+	now      func() time.Time
+
+	file  *os.File
+	buf   *bufio.Writer
+	day   string
+	size  int64
+	swept bool
+}
+
+func (f *rotatingFile) name(day string) string {
+	return filepath.Join(f.dir, f.prefix+day+f.ext)
+}
+
+// WriteLine writes p and a newline, rotating first when needed.
+func (f *rotatingFile) WriteLine(p []byte) error {
+	day := f.now().Format("20060102")
+	full := f.size > 0 && f.size+int64(len(p))+1 > f.maxSize
+	if f.file != nil && (day != f.day || full) {
+		if err := f.rotate(day != f.day); err != nil {
+			return err
+		}
+	}
+	if f.file == nil {
+		if err := f.open(day); err != nil {
+			return err
+		}
+		if !f.swept {
+			f.swept = true
+			if err := f.sweep(); err != nil {
+				return err
+			}
+		}
+	}
+	n, err := f.buf.Write(p)
+	f.size += int64(n)
+	if err != nil {
+		return err
+	}
+	f.size++
+	return f.buf.WriteByte('\n')
+}
+
+func (f *rotatingFile) open(day string) error {
+	if err := os.MkdirAll(f.dir, 0755); err != nil {
+		return fmt.Errorf("create log dir failed: %v", err)
+	}
+	file, err := os.OpenFile(f.name(day), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("open log file failed: %v", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("stat log file failed: %v", err)
+	}
+	f.file = file
+	f.buf = bufio.NewWriter(file)
+	f.day = day
+	f.size = info.Size()
+	return nil
+}
+
+// rotate closes the current file. A full file is moved aside under the next
+// free sequence number first, a finished day keeps its name.
+func (f *rotatingFile) rotate(newDay bool) error {
+	if err := f.Close(); err != nil {
+		return err
+	}
+	rotated := f.name(f.day)
+	if !newDay {
+		for seq := 1; ; seq++ {
+			next := filepath.Join(f.dir, fmt.Sprintf("%s%s.%d%s", f.prefix, f.day, seq, f.ext))
+			if !exists(next) && !exists(next+".gz") {
+				if err := os.Rename(rotated, next); err != nil {
+					return fmt.Errorf("rotate log file failed: %v", err)
+				}
+				rotated = next
+				break
+			}
+		}
+	}
+	if f.compress {
+		if err := gzipFile(rotated); err != nil {
+			return err
+		}
+	}
+	return f.prune()
+}
+
+// sweep compresses and prunes the rotated files already in dir, which a
+// previous process may have left behind when it stopped.
+func (f *rotatingFile) sweep() error {
+	if f.compress {
+		entries, err := os.ReadDir(f.dir)
+		if err != nil {
+			return fmt.Errorf("read log dir failed: %v", err)
+		}
+		for _, e := range entries {
+			path := filepath.Join(f.dir, e.Name())
+			rotated := strings.HasPrefix(e.Name(), f.prefix) && strings.HasSuffix(e.Name(), f.ext)
+			if e.IsDir() || !rotated || path == f.name(f.day) {
+				continue
+			}
+			if err := gzipFile(path); err != nil {
+				return err
+			}
+		}
+	}
+	return f.prune()
+}
+
+// prune deletes the rotated files beyond maxFiles or older than maxAge, the
+// file being written is never touched.
+func (f *rotatingFile) prune() error {
+	entries, err := os.ReadDir(f.dir)
+	if err != nil {
+		return fmt.Errorf("read log dir failed: %v", err)
+	}
+	type rotated struct {
+		path    string
+		modTime time.Time
+	}
+	files := make([]rotated, 0)
+	for _, e := range entries {
+		path := filepath.Join(f.dir, e.Name())
+		active := f.file != nil && path == f.name(f.day)
+		if e.IsDir() || !strings.HasPrefix(e.Name(), f.prefix) || active {
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, rotated{path, info.ModTime()})
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+
+	now := f.now()
+	for i, r := range files {
+		tooMany := f.maxFiles > 0 && i >= f.maxFiles
+		tooOld := f.maxAge > 0 && now.Sub(r.modTime) > f.maxAge
+		if tooMany || tooOld {
+			if err := os.Remove(r.path); err != nil {
+				return fmt.Errorf("delete old log file failed: %v", err)
+			}
+		}
+	}
+	return nil
+}
+
+func (f *rotatingFile) Flush() error {
+	if f.buf == nil {
+		return nil
+	}
+	if err := f.buf.Flush(); err != nil {
+		return fmt.Errorf("flush log file failed: %v", err)
+	}
+	return nil
+}
+
+func (f *rotatingFile) Close() error {
+	if f.file == nil {
+		return nil
+	}
+	flushErr := f.Flush()
+	err := f.file.Close()
+	f.file, f.buf = nil, nil
+	if flushErr != nil {
+		return flushErr
+	}
+	if err != nil {
+		return fmt.Errorf("close log file failed: %v", err)
+	}
+	return nil
+}
+
+func exists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// gzipFile replaces path by path.gz, which keeps the modification time the
+// pruning goes by.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("compress log file failed: %v", err)
+	}
+	defer src.Close()
+	info, err := src.Stat()
+	if err != nil {
+		return fmt.Errorf("compress log file failed: %v", err)
+	}
+
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("compress log file failed: %v", err)
+	}
+	zw := gzip.NewWriter(dst)
+	if _, err := io.Copy(zw, src); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("compress log file failed: %v", err)
+	}
+	if err := zw.Close(); err != nil {
+		dst.Close()
+		os.Remove(path + ".gz")
+		return fmt.Errorf("compress log file failed: %v", err)
+	}
+	if err := dst.Close(); err != nil {
+		return fmt.Errorf("compress log file failed: %v", err)
+	}
+	_ = os.Chtimes(path+".gz", info.ModTime(), info.ModTime())
+	src.Close()
+	return os.Remove(path)
+}
@@ -0,0 +1,82 @@
+package kwanjailogger
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileSweepsLeftoversOnOpen(t *testing.T) {
+	dir := t.TempDir()
+	now := time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)
+
+	// Files a previous process left: today's file it was writing, yesterday's
+	// file it never compressed, and a file past the max age
+	leftovers := map[string]time.Time{
+		"app_20261019.log":   now.Add(-time.Hour),
+		"app_20261018.log":   now.Add(-24 * time.Hour),
+		"app_20260901.log":   now.Add(-48 * 24 * time.Hour),
+		"other_20260901.log": now.Add(-48 * 24 * time.Hour),
+	}
+	for name, modTime := range leftovers {
+		path := filepath.Join(dir, name)
+		if err := os.WriteFile(path, []byte("old\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := &rotatingFile{
+		dir:      dir,
+		prefix:   "app_",
+		ext:      ".log",
+		maxSize:  1 << 20,
+		maxAge:   30 * 24 * time.Hour,
+		compress: true,
+		now:      func() time.Time { return now },
+	}
+	if err := f.WriteLine([]byte("new")); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, e := range entries {
+		got = append(got, e.Name())
+	}
+	sort.Strings(got)
+	want := []string{"app_20261018.log.gz", "app_20261019.log", "other_20260901.log"}
+	if len(got) != len(want) {
+		t.Fatalf("files = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("files = %v, want %v", got, want)
+		}
+	}
+
+	today, err := os.ReadFile(filepath.Join(dir, "app_20261019.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(today) != "old\nnew\n" {
+		t.Errorf("today's file = %q, want the new line appended", today)
+	}
+	info, err := os.Stat(filepath.Join(dir, "app_20261018.log.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !info.ModTime().Equal(leftovers["app_20261018.log"]) {
+		t.Errorf("compressed file modified at %s, want the original time kept", info.ModTime())
+	}
+}
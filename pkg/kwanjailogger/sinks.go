@@ -0,0 +1,195 @@
+package kwanjailogger
+
+import (
+	"context"
+	"errors"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"io"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// sink is one log output with its own lowest level, checked after the
+// package levels.
+type sink struct {
+	name    string
+	level   slog.Level
+	handler slog.Handler
+	closer  func(ctx context.Context) error
+}
+
+// fanout hands every record to the sinks whose level it reaches.
+type fanout []*sink
+
+func (f fanout) Enabled(_ context.Context, level slog.Level) bool {
+	for _, s := range f {
+		if level >= s.level {
+			return true
+		}
+	}
+	return false
+}
+
+func (f fanout) Handle(ctx context.Context, r slog.Record) error {
+	var errs []error
+	for _, s := range f {
+		if r.Level < s.level {
+			continue
+		}
+		if err := s.handler.Handle(ctx, r.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (f fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	next := make(fanout, 0, len(f))
+	for _, s := range f {
+		c := *s
+		c.handler = s.handler.WithAttrs(attrs)
+		next = append(next, &c)
+	}
+	return next
+}
+
+func (f fanout) WithGroup(name string) slog.Handler {
+	next := make(fanout, 0, len(f))
+	for _, s := range f {
+		c := *s
+		c.handler = s.handler.WithGroup(name)
+		next = append(next, &c)
+	}
+	return next
+}
+
+type ISinks interface {
+	// Logger writes to every enabled sink.
+	Logger() *slog.Logger
+	// Close flushes and closes the sinks, the logger must not be used after.
+	Close(ctx context.Context) error
+}
+
+type sinks struct {
+	logger *slog.Logger
+	fanout fanout
+}
+
+// Sinks builds the logger of the server, writing to the sinks enabled in cfg.
+// stdout is where the stdout sink writes.
+func Sinks(cfg config.ILogConfig, stdout io.Writer) (ISinks, error) {
+	if err := Reload(cfg); err != nil {
+		return nil, err
+	}
+	s := new(sinks)
+	add := func(name string, sinkCfg config.ILogSinkConfig, handler slog.Handler, closer func(context.Context) error) {
+		var level slog.Level
+		// The config only accepts valid levels
+		_ = level.UnmarshalText([]byte(sinkCfg.Level()))
+		s.fanout = append(s.fanout, &sink{
+			name:    name,
+			level:   level,
+			handler: handler,
+			closer:  closer,
+		})
+	}
+
+	if cfg.Stdout().Enabled() {
+		add("stdout", cfg.Stdout(), formatHandler(cfg.Format(), stdout), nil)
+	}
+	if cfg.File().Enabled() {
+		w := fileSink(cfg.File())
+		add("file", cfg.File(), jsonHandler(w), w.Close)
+	}
+	if cfg.Syslog().Enabled() {
+		w, err := syslogSink(cfg.Syslog())
+		if err != nil {
+			s.Close(context.Background())
+			return nil, err
+		}
+		add("syslog", cfg.Syslog(), jsonHandler(w), w.Close)
+	}
+	if cfg.Http().Enabled() {
+		w := httpSink(cfg.Http())
+		add("http", cfg.Http(), jsonHandler(w), w.Close)
+	}
+
+	s.logger = slog.New(&handler{inner: s.fanout})
+	return s, nil
+}
+
+func (s *sinks) Logger() *slog.Logger {
+	return s.logger
+}
+
+func (s *sinks) Close(ctx context.Context) error {
+	var errs []error
+	for _, sink := range s.fanout {
+		if sink.closer == nil {
+			continue
+		}
+		if err := sink.closer(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// The sink levels are checked by fanout, let everything through below it.
+var allLevels = &slog.HandlerOptions{Level: slog.LevelDebug}
+
+func formatHandler(format string, w io.Writer) slog.Handler {
+	if format == "text" {
+		return slog.NewTextHandler(w, allLevels)
+	}
+	return slog.NewJSONHandler(w, allLevels)
+}
+
+func jsonHandler(w io.Writer) slog.Handler {
+	return slog.NewJSONHandler(w, allLevels)
+}
+
+// fileLog is the rotating file sink. slog writes one record per Write call,
+// every record is flushed so a crash loses nothing.
+type fileLog struct {
+	mu  sync.Mutex
+	out *rotatingFile
+}
+
+func fileSink(cfg config.ILogFileConfig) *fileLog {
+	return &fileLog{
+		out: &rotatingFile{
+			dir:      cfg.Dir(),
+			prefix:   "app_",
+			ext:      ".log",
+			maxSize:  int64(cfg.MaxSize()),
+			maxAge:   cfg.MaxAge(),
+			maxFiles: cfg.MaxFiles(),
+			compress: cfg.Compress(),
+			now:      time.Now,
+		},
+	}
+}
+
+func (f *fileLog) Write(p []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	// slog ends every record with a newline, WriteLine adds its own
+	if n := len(p); n > 0 && p[n-1] == '\n' {
+		p = p[:n-1]
+	}
+	if err := f.out.WriteLine(p); err != nil {
+		return 0, err
+	}
+	if err := f.out.Flush(); err != nil {
+		return 0, err
+	}
+	return len(p) + 1, nil
+}
+
+func (f *fileLog) Close(context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.out.Close()
+}
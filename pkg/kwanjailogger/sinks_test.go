@@ -0,0 +1,40 @@
+package kwanjailogger
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestFanoutSinkLevels(t *testing.T) {
+	var debug, warn bytes.Buffer
+	f := fanout{
+		{name: "debug", level: slog.LevelDebug, handler: jsonHandler(&debug)},
+		{name: "warn", level: slog.LevelWarn, handler: jsonHandler(&warn)},
+	}
+	logger := slog.New(f).With("package", "test")
+	logger.Debug("quiet")
+	logger.Warn("loud")
+
+	if got := strings.Count(debug.String(), "\n"); got != 2 {
+		t.Errorf("debug sink got %d records, want 2", got)
+	}
+	if got := warn.String(); strings.Contains(got, "quiet") || !strings.Contains(got, "loud") {
+		t.Errorf("warn sink got %q, want the warning only", got)
+	}
+	if !strings.Contains(warn.String(), `"package":"test"`) {
+		t.Error("attrs added to the logger did not reach every sink")
+	}
+}
+
+func TestFanoutEnabled(t *testing.T) {
+	f := fanout{{level: slog.LevelWarn, handler: jsonHandler(new(bytes.Buffer))}}
+	if f.Enabled(context.Background(), slog.LevelInfo) {
+		t.Error("info enabled, want it below every sink level")
+	}
+	if !f.Enabled(context.Background(), slog.LevelError) {
+		t.Error("error disabled, want it enabled")
+	}
+}
@@ -0,0 +1,166 @@
+package kwanjailogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	syslogFacility     = 16 // local0
+	syslogDialTimeout  = 5 * time.Second
+	syslogWriteTimeout = 5 * time.Second
+	syslogRetryBackoff = 500 * time.Millisecond
+	syslogMaxBackoff   = 30 * time.Second
+	// syslogQueueSize is how many records may wait for the server before new
+	// records are dropped.
+	syslogQueueSize = 1000
+)
+
+// syslogLog sends every record as an RFC 5424 message, the JSON record is
+// the message text. Over TCP messages are framed by octet counting
+// (RFC 6587). The records are sent by a goroutine, which dials a broken
+// connection again with a growing backoff and drops the records meanwhile.
+type syslogLog struct {
+	*queue
+	network string
+	address string
+	host    string
+	app     string
+	pid     int
+
+	// Only used by run after syslogSink returns
+	conn      net.Conn
+	closeConn func() bool // stops closing conn on abort
+	backoff   time.Duration
+	retryAt   time.Time
+}
+
+// syslogSink dials the server once so a wrong address fails at boot.
+func syslogSink(cfg config.ILogSyslogConfig) (*syslogLog, error) {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "-"
+	}
+	s := &syslogLog{
+		queue:   newQueue("syslog", syslogQueueSize),
+		network: cfg.Network(),
+		address: cfg.Address(),
+		host:    host,
+		app:     filepath.Base(os.Args[0]),
+		pid:     os.Getpid(),
+	}
+	if err := s.dial(); err != nil {
+		s.cancel()
+		return nil, err
+	}
+	go s.run()
+	return s, nil
+}
+
+func (s *syslogLog) dial() error {
+	dialer := &net.Dialer{Timeout: syslogDialTimeout}
+	conn, err := dialer.DialContext(s.abort, s.network, s.address)
+	if err != nil {
+		return fmt.Errorf("connect to syslog %s failed: %v", s.address, err)
+	}
+	s.conn = conn
+	// Closing the connection unblocks a write stuck on a stalled server
+	s.closeConn = context.AfterFunc(s.abort, func() { conn.Close() })
+	return nil
+}
+
+func (s *syslogLog) hangUp() {
+	if s.conn == nil {
+		return
+	}
+	s.closeConn()
+	s.conn.Close()
+	s.conn = nil
+}
+
+func (s *syslogLog) run() {
+	defer close(s.done)
+	defer s.hangUp()
+	for record := range s.records {
+		if s.abort.Err() != nil || !s.send(s.format(record)) {
+			s.dropped.Add(1)
+		}
+	}
+}
+
+// send writes msg, dialing first when the connection is down and the
+// backoff has passed. A failure drops the connection and grows the backoff.
+func (s *syslogLog) send(msg []byte) bool {
+	if s.conn == nil {
+		if time.Now().Before(s.retryAt) {
+			return false
+		}
+		if err := s.dial(); err != nil {
+			s.retryLater()
+			return false
+		}
+	}
+	_ = s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout))
+	if _, err := s.conn.Write(msg); err != nil {
+		s.hangUp()
+		s.retryLater()
+		return false
+	}
+	s.backoff = 0
+	return true
+}
+
+func (s *syslogLog) retryLater() {
+	s.backoff = min(max(s.backoff*2, syslogRetryBackoff), syslogMaxBackoff)
+	s.retryAt = time.Now().Add(s.backoff)
+}
+
+// syslogTime is the RFC 5424 TIMESTAMP, which allows six fraction digits.
+const syslogTime = "2006-01-02T15:04:05.000000Z07:00"
+
+// format builds <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG. The
+// timestamp is the record's own, it may have waited in the queue.
+func (s *syslogLog) format(p []byte) []byte {
+	var head struct {
+		Time  time.Time `json:"time"`
+		Level string    `json:"level"`
+	}
+	_ = json.Unmarshal(p, &head)
+	if head.Time.IsZero() {
+		head.Time = time.Now()
+	}
+
+	msg := fmt.Sprintf("<%d>1 %s %s %s %d - - %s",
+		syslogFacility*8+severity(head.Level),
+		head.Time.Format(syslogTime),
+		s.host,
+		s.app,
+		s.pid,
+		p,
+	)
+	if s.network == "tcp" {
+		msg = fmt.Sprintf("%d %s", len(msg), msg)
+	}
+	return []byte(msg)
+}
+
+// severity maps a slog level name to the syslog severity.
+func severity(level string) int {
+	switch {
+	case strings.HasPrefix(level, "ERROR"):
+		return 3
+	case strings.HasPrefix(level, "WARN"):
+		return 4
+	case strings.HasPrefix(level, "INFO"):
+		return 6
+	default:
+		return 7
+	}
+}
@@ -0,0 +1,249 @@
+package kwanjailogger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testSyslogConfig struct {
+	network string
+	address string
+}
+
+func (c *testSyslogConfig) Enabled() bool   { return true }
+func (c *testSyslogConfig) Level() string   { return "debug" }
+func (c *testSyslogConfig) Network() string { return c.network }
+func (c *testSyslogConfig) Address() string { return c.address }
+
+// rfc5424 matches <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG.
+var rfc5424 = regexp.MustCompile(`^<(\d{1,3})>1 (\d{4}-\d{2}-\d{2}T\d{2}:\d{2}:\d{2}\.\d{6}(?:Z|[+-]\d{2}:\d{2})) (\S+) (\S+) (\d+) - - (\{.*\})$`)
+
+func checkRfc5424(t *testing.T, msg string, wantPri int, wantMsg string) {
+	t.Helper()
+	m := rfc5424.FindStringSubmatch(msg)
+	if m == nil {
+		t.Fatalf("message is not RFC 5424: %q", msg)
+	}
+	if pri, _ := strconv.Atoi(m[1]); pri != wantPri {
+		t.Errorf("PRI = %d, want %d", pri, wantPri)
+	}
+	if _, err := time.Parse(syslogTime, m[2]); err != nil {
+		t.Errorf("timestamp %q: %v", m[2], err)
+	}
+	if app := filepath.Base(os.Args[0]); m[4] != app {
+		t.Errorf("APP-NAME = %q, want %q", m[4], app)
+	}
+	if m[5] != strconv.Itoa(os.Getpid()) {
+		t.Errorf("PROCID = %q, want the pid", m[5])
+	}
+	if !strings.Contains(m[6], `"msg":"`+wantMsg+`"`) {
+		t.Errorf("MSG = %s, want the record of %q", m[6], wantMsg)
+	}
+}
+
+func TestSyslogSinkUdp(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	s, err := syslogSink(&testSyslogConfig{network: "udp", address: pc.LocalAddr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger := slog.New(jsonHandler(s))
+	logger.Info("hello")
+	logger.Error("broken")
+
+	// local0, informational and error
+	for _, want := range []struct {
+		pri int
+		msg string
+	}{{134, "hello"}, {131, "broken"}} {
+		buf := make([]byte, 64*1024)
+		_ = pc.SetReadDeadline(time.Now().Add(5 * time.Second))
+		n, _, err := pc.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("read %s: %v", want.msg, err)
+		}
+		checkRfc5424(t, string(buf[:n]), want.pri, want.msg)
+	}
+	if err := closeWithin(t, s.Close, 5*time.Second); err != nil {
+		t.Errorf("close: %v", err)
+	}
+}
+
+// readFrame reads one octet counted message, MSG-LEN SP SYSLOG-MSG.
+func readFrame(r *bufio.Reader) (string, error) {
+	size, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSuffix(size, " "))
+	if err != nil {
+		return "", fmt.Errorf("frame length %q: %v", size, err)
+	}
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+	return string(msg), nil
+}
+
+func TestSyslogSinkTcpFraming(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s, err := syslogSink(&testSyslogConfig{network: "tcp", address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger := slog.New(jsonHandler(s))
+	// A newline inside the record must not split the frame
+	logger.Warn("line one\nline two")
+	logger.Debug("second")
+	if err := closeWithin(t, s.Close, 5*time.Second); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	r := bufio.NewReader(conn)
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for _, want := range []struct {
+		pri int
+		msg string
+	}{{132, `line one\nline two`}, {135, "second"}} {
+		msg, err := readFrame(r)
+		if err != nil {
+			t.Fatalf("read %s: %v", want.msg, err)
+		}
+		checkRfc5424(t, msg, want.pri, want.msg)
+	}
+}
+
+func TestSyslogSinkRedials(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s, err := syslogSink(&testSyslogConfig{network: "tcp", address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeWithin(t, s.Close, 5*time.Second)
+
+	// The server drops the first connection
+	first, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		if conn, err := ln.Accept(); err == nil {
+			accepted <- conn
+		}
+	}()
+
+	// Writes fail until the broken connection is noticed, then the sink
+	// dials again once the backoff has passed
+	logger := slog.New(jsonHandler(s))
+	deadline := time.After(10 * time.Second)
+	ticker := time.NewTicker(20 * time.Millisecond)
+	defer ticker.Stop()
+	for i := 0; ; i++ {
+		select {
+		case conn := <-accepted:
+			defer conn.Close()
+			r := bufio.NewReader(conn)
+			_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			if _, err := readFrame(r); err != nil {
+				t.Fatalf("read after redial: %v", err)
+			}
+			if s.dropped.Load() == 0 {
+				t.Error("records written while the server was gone were not counted as dropped")
+			}
+			return
+		case <-deadline:
+			t.Fatal("sink did not dial the server again")
+		case <-ticker.C:
+			logger.Info(fmt.Sprint("record ", i))
+		}
+	}
+}
+
+func TestSyslogSinkFailsAtBoot(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	address := ln.Addr().String()
+	ln.Close()
+
+	if _, err := syslogSink(&testSyslogConfig{network: "tcp", address: address}); err == nil {
+		t.Error("sink started without a server, want the dial error")
+	}
+}
+
+func TestSyslogSinkStalledServer(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	s, err := syslogSink(&testSyslogConfig{network: "tcp", address: ln.Addr().String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The server accepts but never reads
+	conn, err := ln.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Enough to fill the socket buffers and the queue behind them
+	logger := slog.New(jsonHandler(s))
+	payload := strings.Repeat("x", 4096)
+	start := time.Now()
+	for i := 0; i < 5*syslogQueueSize; i++ {
+		logger.Info("stalled", "payload", payload)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("logging took %s, want it not to wait for the server", elapsed)
+	}
+	if s.dropped.Load() == 0 {
+		t.Error("no record was dropped, want the full queue to drop")
+	}
+
+	start = time.Now()
+	if err := closeWithin(t, s.Close, 100*time.Millisecond); err == nil {
+		t.Error("close succeeded, want a timeout")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("close took %s after its deadline", elapsed)
+	}
+}
@@ -0,0 +1,59 @@
+package kwanjaimetrics
+
+import (
+	"database/sql"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// dbStatsCollector reads the pool stats at scrape time, so replicas added or
+// reconnected later are reported too.
+type dbStatsCollector struct {
+	stats func() map[string]sql.DBStats
+}
+
+func dbDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(prometheus.BuildFQName(namespace, "db", name), help, []string{"pool"}, nil)
+}
+
+var (
+	dbMaxOpen           = dbDesc("max_open_connections", "Maximum number of open connections.")
+	dbOpen              = dbDesc("open_connections", "Established connections, in use and idle.")
+	dbInUse             = dbDesc("in_use_connections", "Connections currently in use.")
+	dbIdle              = dbDesc("idle_connections", "Idle connections.")
+	dbWaitCount         = dbDesc("wait_count_total", "Connections waited for.")
+	dbWaitDuration      = dbDesc("wait_duration_seconds_total", "Time blocked waiting for a connection.")
+	dbMaxIdleClosed     = dbDesc("max_idle_closed_total", "Connections closed due to the idle limit.")
+	dbMaxIdleTimeClosed = dbDesc("max_idle_time_closed_total", "Connections closed due to the idle time limit.")
+	dbMaxLifetimeClosed = dbDesc("max_lifetime_closed_total", "Connections closed due to the lifetime limit.")
+)
+
+func (c *dbStatsCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, d := range []*prometheus.Desc{
+		dbMaxOpen,
+		dbOpen,
+		dbInUse,
+		dbIdle,
+		dbWaitCount,
+		dbWaitDuration,
+		dbMaxIdleClosed,
+		dbMaxIdleTimeClosed,
+		dbMaxLifetimeClosed,
+	} {
+		ch <- d
+	}
+}
+
+func (c *dbStatsCollector) Collect(ch chan<- prometheus.Metric) {
+	for pool, s := range c.stats() {
+		ch <- prometheus.MustNewConstMetric(dbMaxOpen, prometheus.GaugeValue, float64(s.MaxOpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(dbOpen, prometheus.GaugeValue, float64(s.OpenConnections), pool)
+		ch <- prometheus.MustNewConstMetric(dbInUse, prometheus.GaugeValue, float64(s.InUse), pool)
+		ch <- prometheus.MustNewConstMetric(dbIdle, prometheus.GaugeValue, float64(s.Idle), pool)
+		ch <- prometheus.MustNewConstMetric(dbWaitCount, prometheus.CounterValue, float64(s.WaitCount), pool)
+		ch <- prometheus.MustNewConstMetric(dbWaitDuration, prometheus.CounterValue, s.WaitDuration.Seconds(), pool)
+		ch <- prometheus.MustNewConstMetric(dbMaxIdleClosed, prometheus.CounterValue, float64(s.MaxIdleClosed), pool)
+		ch <- prometheus.MustNewConstMetric(dbMaxIdleTimeClosed, prometheus.CounterValue, float64(s.MaxIdleTimeClosed), pool)
+		ch <- prometheus.MustNewConstMetric(dbMaxLifetimeClosed, prometheus.CounterValue, float64(s.MaxLifetimeClosed), pool)
+	}
+}
@@ -0,0 +1,119 @@
+package kwanjaimetrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "kwanjai"
+
+// Registry holds every metric of the application, the Go runtime and the
+// process metrics included.
+var Registry = prometheus.NewRegistry()
+
+var (
+	httpRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "http_requests_total",
+		Help:      "HTTP requests by route template, method and status.",
+	}, []string{"route", "method", "status"})
+
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "HTTP request latency by route template, method and status.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "status"})
+
+	signIns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_sign_ins_total",
+		Help:      "Sign in attempts by outcome.",
+	}, []string{"outcome"})
+
+	refreshes = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_refreshes_total",
+		Help:      "Passport refreshes by outcome.",
+	}, []string{"outcome"})
+
+	tokenRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "auth_token_rejections_total",
+		Help:      "Rejected tokens by reason.",
+	}, []string{"reason"})
+
+	signUps = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "users_sign_ups_total",
+		Help:      "Accounts created by role.",
+	}, []string{"role"})
+)
+
+// Outcomes of sign in and refresh.
+const (
+	Success = "success"
+	Failure = "failure"
+)
+
+func init() {
+	Registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpRequests,
+		httpDuration,
+		signIns,
+		refreshes,
+		tokenRejections,
+		signUps,
+	)
+}
+
+// Handler serves the registry in the Prometheus text format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{Registry: Registry})
+}
+
+func ObserveRequest(route, method string, status int, d time.Duration) {
+	code := strconv.Itoa(status)
+	httpRequests.WithLabelValues(route, method, code).Inc()
+	httpDuration.WithLabelValues(route, method, code).Observe(d.Seconds())
+}
+
+// Outcome is Success when err is nil, Failure otherwise.
+func Outcome(err error) string {
+	if err != nil {
+		return Failure
+	}
+	return Success
+}
+
+func SignIn(outcome string) {
+	signIns.WithLabelValues(outcome).Inc()
+}
+
+func Refresh(outcome string) {
+	refreshes.WithLabelValues(outcome).Inc()
+}
+
+// TokenRejected counts a token refused for reason, e.g. expired, revoked, or
+// lookup_error when the token could not be checked.
+func TokenRejected(reason string) {
+	tokenRejections.WithLabelValues(reason).Inc()
+}
+
+func SignUp(role string) {
+	signUps.WithLabelValues(role).Inc()
+}
+
+// RegisterDbStats exports the pool stats stats returns, one series per
+// connection pool name.
+func RegisterDbStats(stats func() map[string]sql.DBStats) error {
+	return Registry.Register(&dbStatsCollector{stats: stats})
+}
@@ -0,0 +1,151 @@
+package kwanjaipassword
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	argon2SaltLength = 16
+	argon2KeyLength  = 32
+	argon2Prefix     = "$argon2id$"
+)
+
+type IHasher interface {
+	// Hash hashes a new password with the configured algorithm.
+	Hash(password string) (string, error)
+	// Verify reports whether password matches hash, whatever algorithm made it.
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash reports whether hash was made with another algorithm or
+	// weaker parameters than the configured ones.
+	NeedsRehash(hash string) bool
+}
+
+type hasher struct {
+	cfg config.IPasswordConfig
+}
+
+func Hasher(cfg config.IPasswordConfig) IHasher {
+	return &hasher{
+		cfg: cfg,
+	}
+}
+
+func (h *hasher) Hash(password string) (string, error) {
+	if h.cfg.Hash() == "argon2id" {
+		return h.argon2Hash(password)
+	}
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), h.cfg.BcryptCost())
+	if err != nil {
+		return "", fmt.Errorf("hashed password failed: %v", err)
+	}
+	return string(hashed), nil
+}
+
+func (h *hasher) Verify(hash, password string) (bool, error) {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		p, err := parseArgon2(hash)
+		if err != nil {
+			return false, err
+		}
+		key := argon2.IDKey([]byte(password), p.salt, p.iterations, p.memory, p.threads, uint32(len(p.key)))
+		return subtle.ConstantTimeCompare(key, p.key) == 1, nil
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("compare password failed: %v", err)
+	}
+	return true, nil
+}
+
+func (h *hasher) NeedsRehash(hash string) bool {
+	if strings.HasPrefix(hash, argon2Prefix) {
+		if h.cfg.Hash() != "argon2id" {
+			return true
+		}
+		p, err := parseArgon2(hash)
+		if err != nil {
+			return true
+		}
+		return p.memory < h.argon2Memory() ||
+			p.iterations < uint32(h.cfg.Argon2Iterations()) ||
+			p.threads < uint8(h.cfg.Argon2Threads())
+	}
+
+	if h.cfg.Hash() != "bcrypt" {
+		return true
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	return err != nil || cost < h.cfg.BcryptCost()
+}
+
+// argon2Memory is the configured memory in KiB, the unit argon2 works in.
+func (h *hasher) argon2Memory() uint32 {
+	return uint32(h.cfg.Argon2Memory() / 1024)
+}
+
+// argon2Hash encodes like the reference implementation:
+// $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>
+func (h *hasher) argon2Hash(password string) (string, error) {
+	salt := make([]byte, argon2SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", fmt.Errorf("hashed password failed: %v", err)
+	}
+	memory := h.argon2Memory()
+	iterations := uint32(h.cfg.Argon2Iterations())
+	threads := uint8(h.cfg.Argon2Threads())
+	key := argon2.IDKey([]byte(password), salt, iterations, memory, threads, argon2KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2Prefix,
+		argon2.Version,
+		memory,
+		iterations,
+		threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+type argon2Params struct {
+	memory     uint32
+	iterations uint32
+	threads    uint8
+	salt       []byte
+	key        []byte
+}
+
+func parseArgon2(hash string) (*argon2Params, error) {
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return nil, fmt.Errorf("argon2id hash format is invalid")
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return nil, fmt.Errorf("argon2id version is not supported")
+	}
+	p := new(argon2Params)
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.iterations, &p.threads); err != nil {
+		return nil, fmt.Errorf("argon2id parameters are invalid: %v", err)
+	}
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return nil, fmt.Errorf("argon2id salt is invalid: %v", err)
+	}
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return nil, fmt.Errorf("argon2id key is invalid: %v", err)
+	}
+	return p, nil
+}
@@ -0,0 +1,121 @@
+package kwanjaipassword
+
+import (
+	_ "embed"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"strings"
+	"unicode"
+)
+
+//go:embed common.txt
+var commonFile string
+
+var common = func() map[string]bool {
+	words := make(map[string]bool)
+	for _, line := range strings.Split(commonFile, "\n") {
+		if line = strings.TrimSpace(line); line != "" && !strings.HasPrefix(line, "#") {
+			words[strings.ToLower(line)] = true
+		}
+	}
+	return words
+}()
+
+// maxLength is bcrypt's limit in bytes. It holds whatever the configured
+// hash, a password may be hashed again with bcrypt after a config change.
+const maxLength = 72
+
+// minPersonalLength keeps short usernames like "jo" from rejecting most passwords.
+const minPersonalLength = 3
+
+// CheckPolicy checks a new password against the configured policy, email and
+// username are the account's own values which the password may not contain.
+// The error is a Validation apperror with one field error per broken rule.
+func CheckPolicy(cfg config.IPasswordConfig, password, email, username string) error {
+	fields := make([]*apperrors.FieldError, 0)
+	fail := func(rule, msg string) {
+		fields = append(fields, &apperrors.FieldError{
+			Field:   "password",
+			Rule:    rule,
+			Message: msg,
+		})
+	}
+
+	if n := len([]rune(password)); n < cfg.MinLength() {
+		fail("min", fmt.Sprintf("must be at least %d characters", cfg.MinLength()))
+	}
+	if len(password) > maxLength {
+		fail("max", fmt.Sprintf("must be at most %d bytes", maxLength))
+	}
+	for _, class := range cfg.CharacterClasses() {
+		if !hasClass(password, class) {
+			fail("class", fmt.Sprintf("must contain a %s character", classNames[class]))
+		}
+	}
+	if denied(cfg, password) {
+		fail("denied", "is too common")
+	}
+	lower := strings.ToLower(password)
+	local, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, personal := range []string{local, strings.ToLower(username)} {
+		if len(personal) >= minPersonalLength && strings.Contains(lower, personal) {
+			fail("personal", "must not contain the email or username")
+			break
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+	return apperrors.NewFieldsValidation(fields)
+}
+
+var classNames = map[string]string{
+	"lower":  "lowercase",
+	"upper":  "uppercase",
+	"letter": "letter",
+	"digit":  "digit",
+	"symbol": "symbol",
+}
+
+func hasClass(password, class string) bool {
+	for _, r := range password {
+		switch class {
+		case "lower":
+			if unicode.IsLower(r) {
+				return true
+			}
+		case "upper":
+			if unicode.IsUpper(r) {
+				return true
+			}
+		case "letter":
+			if unicode.IsLetter(r) {
+				return true
+			}
+		case "digit":
+			if unicode.IsDigit(r) {
+				return true
+			}
+		case "symbol":
+			if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsSpace(r) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func denied(cfg config.IPasswordConfig, password string) bool {
+	lower := strings.ToLower(password)
+	if common[lower] {
+		return true
+	}
+	for _, word := range cfg.DenyList() {
+		if strings.ToLower(word) == lower {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,64 @@
+package kwanjaitrace
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+	fiberutils "github.com/gofiber/fiber/v2/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// StartRequest starts the server span of c, joined to the caller's trace
+// when the request carries a traceparent header.
+func StartRequest(c *fiber.Ctx) (context.Context, trace.Span) {
+	ctx := otel.GetTextMapPropagator().Extract(c.UserContext(), headerCarrier{c: c})
+	return tracer().Start(ctx, c.Method(),
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(c.Method()),
+			semconv.URLPath(fiberutils.CopyString(c.Path())),
+			semconv.UserAgentOriginal(fiberutils.CopyString(c.Get(fiber.HeaderUserAgent))),
+			semconv.ClientAddress(c.IP()),
+		),
+	)
+}
+
+// EndRequest names span after the route template, so requests to the same
+// route group together, records the status and ends it. Only a 5xx is an
+// error of the server.
+func EndRequest(span trace.Span, method, route string, status int) {
+	span.SetName(method + " " + route)
+	span.SetAttributes(semconv.HTTPRoute(route), semconv.HTTPResponseStatusCode(status))
+	if status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, http.StatusText(status))
+	}
+	span.End()
+}
+
+// Handler runs next in a span of its own, so the time spent in the handler
+// stands apart from the middlewares before it.
+func Handler(name string, next fiber.Handler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		parent := c.UserContext()
+		ctx, span := Start(parent, name)
+		c.SetUserContext(ctx)
+		err := next(c)
+		c.SetUserContext(parent)
+		End(span, err)
+		return err
+	}
+}
+
+// headerCarrier reads the propagation headers of a Fiber request. The
+// values point into a buffer fasthttp reuses, so they are copied.
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string { return fiberutils.CopyString(h.c.Get(key)) }
+func (h headerCarrier) Set(key, value string) {}
+func (h headerCarrier) Keys() []string        { return nil }
@@ -0,0 +1,162 @@
+package kwanjaitrace
+
+import (
+	"context"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/config"
+	"io"
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.21.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const instrumentation = "github/Panyakorn4/kwanjai-shop-tutorial"
+
+// tracer is looked up on every call so spans follow the provider set by
+// Provider, before that they are no-ops.
+func tracer() trace.Tracer {
+	return otel.Tracer(instrumentation)
+}
+
+type IProvider interface {
+	// Close exports the spans still buffered, spans started after are dropped.
+	Close(ctx context.Context) error
+}
+
+type provider struct {
+	sdk *sdktrace.TracerProvider
+}
+
+// Provider installs the global tracer provider and the W3C trace context
+// propagator. When tracing is disabled only the propagator is installed, so
+// an incoming trace id still reaches the logs and error responses.
+// stdout is where the stdout exporter writes.
+func Provider(cfg config.IConfig, stdout io.Writer) (IProvider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	traceCfg := cfg.Trace()
+	if !traceCfg.Enabled() {
+		return &provider{}, nil
+	}
+
+	var (
+		exporter sdktrace.SpanExporter
+		err      error
+	)
+	switch traceCfg.Exporter() {
+	case "stdout":
+		exporter, err = stdouttrace.New(stdouttrace.WithWriter(stdout))
+	default:
+		opts := []otlptracehttp.Option{
+			otlptracehttp.WithEndpoint(traceCfg.OtlpEndpoint()),
+			otlptracehttp.WithHeaders(traceCfg.OtlpHeaders()),
+		}
+		if traceCfg.OtlpInsecure() {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		// The exporter only connects when the first batch is sent
+		exporter, err = otlptracehttp.New(context.Background(), opts...)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("create %s trace exporter failed: %v", traceCfg.Exporter(), err)
+	}
+
+	res, err := resource.Merge(resource.Default(), resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceName(traceCfg.ServiceName()),
+		semconv.ServiceVersion(cfg.App().Version()),
+	))
+	if err != nil {
+		return nil, fmt.Errorf("create trace resource failed: %v", err)
+	}
+
+	sdk := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(traceCfg.SampleRatio()))),
+	)
+	otel.SetTracerProvider(sdk)
+	return &provider{sdk: sdk}, nil
+}
+
+func (p *provider) Close(ctx context.Context) error {
+	if p.sdk == nil {
+		return nil
+	}
+	if err := p.sdk.Shutdown(ctx); err != nil {
+		return fmt.Errorf("close tracer provider failed: %v", err)
+	}
+	return nil
+}
+
+// Start starts an internal span, a child of the span in ctx if any.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceId returns the trace id of the span in ctx, empty when there is none.
+func TraceId(ctx context.Context) string {
+	if sc := trace.SpanContextFromContext(ctx); sc.HasTraceID() {
+		return sc.TraceID().String()
+	}
+	return ""
+}
+
+// Transport starts a client span for every request sent through base and
+// propagates the trace to the server in the request headers.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := tracer().Start(req.Context(), "HTTP "+req.Method,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPRequestMethodKey.String(req.Method),
+			semconv.ServerAddress(req.URL.Hostname()),
+			semconv.URLPath(req.URL.Path),
+		),
+	)
+	// RoundTrip must not modify the caller's request
+	req = req.Clone(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		End(span, err)
+		return nil, err
+	}
+	span.SetAttributes(semconv.HTTPResponseStatusCode(res.StatusCode))
+	if res.StatusCode >= 500 {
+		span.SetStatus(codes.Error, res.Status)
+	}
+	span.End()
+	return res, nil
+}
@@ -0,0 +1,71 @@
+package kwanjaitrace
+
+import (
+	"strings"
+	"unicode"
+)
+
+// maxStatementLength keeps a generated statement from bloating a span.
+const maxStatementLength = 2048
+
+// SanitizeSql prepares a statement for a span: string and number literals
+// become ?, so values inlined in the SQL never leave the process, and runs
+// of whitespace become one space. $n placeholders are kept.
+func SanitizeSql(query string) string {
+	var b strings.Builder
+	b.Grow(len(query))
+	space := false
+	for i := 0; i < len(query); {
+		c := query[i]
+		switch {
+		case c == '\'':
+			// A quote inside the literal is doubled
+			i++
+			for i < len(query) {
+				if query[i] == '\'' {
+					if i+1 < len(query) && query[i+1] == '\'' {
+						i += 2
+						continue
+					}
+					break
+				}
+				i++
+			}
+			i++
+			writeToken(&b, &space, "?")
+		case c >= '0' && c <= '9' && !partOfWord(query, i):
+			for i < len(query) && (query[i] >= '0' && query[i] <= '9' || query[i] == '.') {
+				i++
+			}
+			writeToken(&b, &space, "?")
+		case unicode.IsSpace(rune(c)):
+			space = b.Len() > 0
+			i++
+		default:
+			writeToken(&b, &space, string(c))
+			i++
+		}
+		if b.Len() >= maxStatementLength {
+			return b.String()[:maxStatementLength] + "..."
+		}
+	}
+	return b.String()
+}
+
+func writeToken(b *strings.Builder, space *bool, token string) {
+	if *space {
+		b.WriteByte(' ')
+		*space = false
+	}
+	b.WriteString(token)
+}
+
+// partOfWord reports whether the digit at i belongs to an identifier or a
+// $n placeholder rather than starting a number.
+func partOfWord(query string, i int) bool {
+	if i == 0 {
+		return false
+	}
+	p := query[i-1]
+	return p == '$' || p == '_' || p >= 'a' && p <= 'z' || p >= 'A' && p <= 'Z' || p >= '0' && p <= '9'
+}
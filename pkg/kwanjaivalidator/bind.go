@@ -0,0 +1,31 @@
+package kwanjaivalidator
+
+import (
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+// BindBody parses the request body into a new T and validates it.
+func BindBody[T any](c *fiber.Ctx) (*T, error) {
+	req := new(T)
+	if err := c.BodyParser(req); err != nil {
+		return nil, apperrors.Wrap(apperrors.Validation, err, "request body is invalid")
+	}
+	if err := Validate(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
+
+// BindQuery parses the query string into a new T and validates it.
+func BindQuery[T any](c *fiber.Ctx) (*T, error) {
+	req := new(T)
+	if err := c.QueryParser(req); err != nil {
+		return nil, apperrors.Wrap(apperrors.Validation, err, "query string is invalid")
+	}
+	if err := Validate(req); err != nil {
+		return nil, err
+	}
+	return req, nil
+}
@@ -0,0 +1,98 @@
+package kwanjaivalidator
+
+import (
+	"errors"
+	"fmt"
+	"github/Panyakorn4/kwanjai-shop-tutorial/pkg/apperrors"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+var (
+	validate = newValidator()
+
+	usernamePattern = regexp.MustCompile(`^[a-zA-Z0-9_.-]+$`)
+)
+
+func newValidator() *validator.Validate {
+	v := validator.New(validator.WithRequiredStructEnabled())
+	// Report fields by the name the client sent, json first, then form
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		for _, tag := range []string{"json", "form"} {
+			name := strings.SplitN(f.Tag.Get(tag), ",", 2)[0]
+			if name != "" && name != "-" {
+				return name
+			}
+		}
+		return f.Name
+	})
+	v.RegisterValidation("username", func(fl validator.FieldLevel) bool {
+		return usernamePattern.MatchString(fl.Field().String())
+	})
+	return v
+}
+
+// Validate checks the validate tags of s, a struct or a pointer to one. The
+// error is a Validation apperror listing every failed field.
+func Validate(s any) error {
+	return fieldsError(validate.Struct(s))
+}
+
+func fieldsError(err error) error {
+	if err == nil {
+		return nil
+	}
+	var verrs validator.ValidationErrors
+	if !errors.As(err, &verrs) {
+		return apperrors.NewInternal(err, "validate request failed")
+	}
+	fields := make([]*apperrors.FieldError, 0, len(verrs))
+	for _, fe := range verrs {
+		fields = append(fields, &apperrors.FieldError{
+			Field:   fieldPath(fe),
+			Rule:    fe.Tag(),
+			Message: message(fe),
+		})
+	}
+	return apperrors.NewFieldsValidation(fields)
+}
+
+// fieldPath drops the struct name from the namespace, so a nested field reads
+// as address.city.
+func fieldPath(fe validator.FieldError) string {
+	ns := fe.Namespace()
+	if i := strings.Index(ns, "."); i >= 0 {
+		return ns[i+1:]
+	}
+	return fe.Field()
+}
+
+func message(fe validator.FieldError) string {
+	switch fe.Tag() {
+	case "required":
+		return "is required"
+	case "email":
+		return "must be a valid email address"
+	case "uuid", "uuid4":
+		return "must be a valid uuid"
+	case "min":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at least %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at least %s", fe.Param())
+	case "max":
+		if fe.Kind() == reflect.String {
+			return fmt.Sprintf("must be at most %s characters", fe.Param())
+		}
+		return fmt.Sprintf("must be at most %s", fe.Param())
+	case "oneof":
+		return fmt.Sprintf("must be one of %s", strings.Join(strings.Fields(fe.Param()), ", "))
+	case "username":
+		return "may only contain letters, digits, '_', '.' and '-'"
+	default:
+		return fmt.Sprintf("failed the %s rule", fe.Tag())
+	}
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	fiberutils "github.com/gofiber/fiber/v2/utils"
+
+	"github.com/gofiber/fiber/v2"
+)
+
+const (
+	requestIdKey       = "requestId"
+	maxRequestIdLength = 128
+)
+
+// RequestId returns the id of the request. The first call takes the client's
+// X-Request-ID when it is usable, generates one otherwise, stores it in the
+// locals and echoes it in the response header.
+func RequestId(c *fiber.Ctx) string {
+	if id, ok := c.Locals(requestIdKey).(string); ok {
+		return id
+	}
+	// Header values point into a buffer fasthttp reuses, keep a copy
+	id := fiberutils.CopyString(c.Get(fiber.HeaderXRequestID))
+	if !validRequestId(id) {
+		id = fiberutils.UUIDv4()
+	}
+	c.Locals(requestIdKey, id)
+	c.Set(fiber.HeaderXRequestID, id)
+	return id
+}
+
+// validRequestId keeps ids short and printable so they are safe in logs.
+func validRequestId(id string) bool {
+	if id == "" || len(id) > maxRequestIdLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}